@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReleaseManifest describes the desired state of a release, as read by the
+// apply command from YAML or JSON:
+//
+//	tag: v1.2.0
+//	target: main
+//	name: Version 1.2.0
+//	body_file: CHANGELOG.md
+//	prerelease: true
+//	assets:
+//	  - path: dist/*.tar.gz
+//	  - path: dist/app.exe
+//	    name: app-windows-amd64.exe
+//	    label: Windows (amd64)
+//	prune: true
+type ReleaseManifest struct {
+	User       string          `yaml:"user"`
+	Repo       string          `yaml:"repo"`
+	Tag        string          `yaml:"tag"`
+	Target     string          `yaml:"target"`
+	Name       string          `yaml:"name"`
+	Body       string          `yaml:"body"`
+	BodyFile   string          `yaml:"body_file"`
+	Draft      bool            `yaml:"draft"`
+	Prerelease bool            `yaml:"prerelease"`
+	Assets     []ManifestAsset `yaml:"assets"`
+	// Prune deletes assets of the release that aren't listed in Assets.
+	Prune bool `yaml:"prune"`
+}
+
+// ManifestAsset is a file to attach to the release. Path may be a glob
+// pattern, in which case Name must be empty.
+type ManifestAsset struct {
+	Path  string `yaml:"path"`
+	Name  string `yaml:"name"`
+	Label string `yaml:"label"`
+}
+
+// readManifest parses a manifest from f. Relative paths in the manifest
+// are resolved against the directory f lives in.
+func readManifest(f *os.File) (*ReleaseManifest, error) {
+	var m ReleaseManifest
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("manifest %s is empty", f.Name())
+		}
+		return nil, fmt.Errorf("could not parse manifest %s: %v", f.Name(), err)
+	}
+	if m.Tag == "" {
+		return nil, fmt.Errorf("manifest %s does not specify a tag", f.Name())
+	}
+	if m.Body != "" && m.BodyFile != "" {
+		return nil, fmt.Errorf("manifest %s specifies both body and body_file", f.Name())
+	}
+
+	dir := "."
+	if f != os.Stdin {
+		dir = filepath.Dir(f.Name())
+	}
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	if m.BodyFile != "" {
+		b, err := os.ReadFile(resolve(m.BodyFile))
+		if err != nil {
+			return nil, fmt.Errorf("could not read body file: %v", err)
+		}
+		m.Body = string(b)
+	}
+	for i := range m.Assets {
+		if m.Assets[i].Path == "" {
+			return nil, fmt.Errorf("manifest %s: asset %d has no path", f.Name(), i+1)
+		}
+		m.Assets[i].Path = resolve(m.Assets[i].Path)
+	}
+	m.Name = nvls(m.Name, m.Tag)
+	return &m, nil
+}
+
+// manifestFile is a local file the manifest wants attached to the release.
+type manifestFile struct {
+	uploadFile
+	Label string
+}
+
+// expand turns the manifest assets into the list of local files to attach,
+// expanding glob patterns.
+func (m *ReleaseManifest) expand() ([]*manifestFile, error) {
+	var files []*manifestFile
+	names := make(map[string]string)
+	for _, a := range m.Assets {
+		expanded, err := expandUploadFiles([]string{a.Path}, a.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range expanded {
+			if f.Path == "-" {
+				return nil, fmt.Errorf("manifest assets cannot be read from stdin")
+			}
+			if other, ok := names[f.Name]; ok {
+				return nil, fmt.Errorf("%s and %s would both be uploaded as %s", other, f.Path, f.Name)
+			}
+			names[f.Name] = f.Path
+			files = append(files, &manifestFile{uploadFile: *f, Label: a.Label})
+		}
+	}
+	return files, nil
+}
+
+// applyManifest makes the release described by m exist on Github exactly
+// as described, reporting every change it makes to report. A release that
+// is to be published is kept (or created) as a draft until all assets are
+// in place.
+func applyManifest(user, repo, authUser, token string, m *ReleaseManifest, policy RetryPolicy, report func(format string, a ...interface{})) error {
+	files, err := m.expand()
+	if err != nil {
+		return err
+	}
+
+	want := ReleaseCreate{
+		TagName:         m.Tag,
+		TargetCommitish: m.Target,
+		Name:            m.Name,
+		Body:            m.Body,
+		Draft:           m.Draft,
+		Prerelease:      m.Prerelease,
+	}
+
+	// A new release has no assets yet, so there is nothing to list.
+	var assets []Asset
+	rel, err := ReleaseOfTag(user, repo, m.Tag, authUser, token)
+	var notFound releaseNotFoundError
+	if errors.As(err, &notFound) {
+		create := want
+		create.Draft = m.Draft || len(files) > 0
+		if rel, err = CreateRelease(user, repo, token, create); err != nil {
+			return err
+		}
+		report("release %s: created", m.Tag)
+	} else if err != nil {
+		return err
+	} else if assets, err = ReleaseAssets(user, repo, authUser, token, rel.Id); err != nil {
+		return err
+	}
+
+	failed := 0
+	wanted := make(map[string]bool)
+	for _, f := range files {
+		wanted[f.Name] = true
+		action, err := applyAsset(user, repo, authUser, token, rel, assets, f, policy)
+		if err != nil {
+			report("%s: failed: %v", f.Name, err)
+			failed++
+			continue
+		}
+		report("%s: %s", f.Name, action)
+	}
+	if failed > 0 {
+		// Don't publish a release that is missing assets.
+		return fmt.Errorf("%d of %d assets could not be applied", failed, len(files))
+	}
+
+	if m.Prune {
+		for i := range assets {
+			asset := &assets[i]
+			if wanted[asset.Name] {
+				continue
+			}
+			if err := deleteAsset(user, repo, token, asset); err != nil {
+				return err
+			}
+			report("%s: deleted", asset.Name)
+		}
+	}
+
+	changed := releaseChanges(rel, want)
+	if len(changed) == 0 {
+		return nil
+	}
+	if _, err := EditRelease(user, repo, token, rel.Id, want); err != nil {
+		return err
+	}
+	if len(changed) == 1 && changed[0] == "draft" && !want.Draft {
+		report("release %s: published", m.Tag)
+	} else {
+		report("release %s: updated %s", m.Tag, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// releaseChanges lists the fields of rel that differ from want. An empty
+// target leaves the target of rel alone.
+func releaseChanges(rel *Release, want ReleaseCreate) []string {
+	var changed []string
+	if want.TargetCommitish != "" && rel.Target != want.TargetCommitish {
+		changed = append(changed, "target")
+	}
+	if rel.Name != want.Name {
+		changed = append(changed, "name")
+	}
+	if rel.Description != want.Body {
+		changed = append(changed, "body")
+	}
+	if rel.Draft != want.Draft {
+		changed = append(changed, "draft")
+	}
+	if rel.Prerelease != want.Prerelease {
+		changed = append(changed, "prerelease")
+	}
+	return changed
+}
+
+// applyAsset makes sure the asset f.Name of rel has the contents of the
+// local file and the desired label, and describes what it had to do.
+//
+// Contents are compared by SHA-256. Assets Github reports no digest for are
+// downloaded to compute it, unless their size already differs.
+func applyAsset(user, repo, authUser, token string, rel *Release, assets []Asset, f *manifestFile, policy RetryPolicy) (string, error) {
+	existing := findAsset(assets, f.Name)
+	if existing == nil || existing.State != "uploaded" {
+		_, err := uploadPath(user, repo, authUser, token, rel, assets, &f.uploadFile, f.Label, false, policy)
+		return "uploaded", err
+	}
+
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		return "", err
+	}
+	same := uint64(fi.Size()) == existing.Size
+	if same {
+		local, err := hashFile(f.Path)
+		if err != nil {
+			return "", err
+		}
+		remote, err := assetChecksum(user, repo, rel.TagName, token, existing)
+		if err != nil {
+			return "", err
+		}
+		same = local == remote
+	}
+	if !same {
+		_, err := uploadPath(user, repo, authUser, token, rel, assets, &f.uploadFile, f.Label, true, policy)
+		return "replaced", err
+	}
+
+	if existing.Label != f.Label {
+		return "label updated", editAsset(user, repo, token, existing, existing.Name, f.Label)
+	}
+	return "unchanged", nil
+}
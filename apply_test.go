@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("NOTES.md", "notes\n")
+	open := func(path string) *os.File {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	m, err := readManifest(open(write("release.yaml", `
+tag: v1.0.0
+body_file: NOTES.md
+assets:
+  - path: dist/*.zip
+  - path: /abs/app
+    name: app-linux
+    label: Linux
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ReleaseManifest{
+		Tag:  "v1.0.0",
+		Name: "v1.0.0",
+		Body: "notes\n",
+		Assets: []ManifestAsset{
+			{Path: filepath.Join(dir, "dist/*.zip")},
+			{Path: "/abs/app", Name: "app-linux", Label: "Linux"},
+		},
+		BodyFile: "NOTES.md",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("readManifest = %+v, want %+v", m, want)
+	}
+
+	m, err = readManifest(open(write("release.json", `{"tag": "v2", "name": "Two", "prerelease": true}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Two" || !m.Prerelease {
+		t.Errorf("JSON manifest parsed as %+v", m)
+	}
+
+	for _, bad := range []string{
+		"",
+		"name: no tag",
+		"tag: v1\nunknown: field",
+		"tag: v1\nbody: a\nbody_file: NOTES.md",
+		"tag: v1\nassets:\n  - name: no-path",
+	} {
+		if _, err := readManifest(open(write("bad.yaml", bad))); err == nil {
+			t.Errorf("readManifest(%q) should fail", bad)
+		}
+	}
+}
+
+func TestReleaseChanges(t *testing.T) {
+	rel := &Release{Name: "v1", Description: "notes", Target: "main", Draft: true}
+	want := ReleaseCreate{Name: "v1", Body: "new notes", Prerelease: true}
+	got := releaseChanges(rel, want)
+	if !reflect.DeepEqual(got, []string{"body", "draft", "prerelease"}) {
+		t.Errorf("releaseChanges = %v", got)
+	}
+
+	want = ReleaseCreate{TargetCommitish: "release-1.x", Name: "v1", Body: "notes", Draft: true}
+	if got := releaseChanges(rel, want); !reflect.DeepEqual(got, []string{"target"}) {
+		t.Errorf("releaseChanges with a new target = %v", got)
+	}
+	want.TargetCommitish = "main"
+	if got := releaseChanges(rel, want); len(got) != 0 {
+		t.Errorf("releaseChanges with the same target = %v", got)
+	}
+}
+
+func TestApplyAsset(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing Asset
+		contents string // Of the existing asset.
+		label    string
+		want     string
+	}{
+		{name: "digest matches", existing: Asset{Digest: "sha256:" + sha256Hex("contents")}, want: "unchanged"},
+		{name: "digest differs", existing: Asset{Digest: "sha256:" + sha256Hex("CONTENTS")}, want: "replaced"},
+		{name: "no digest, same contents", contents: "contents", want: "unchanged"},
+		{name: "no digest, same size", contents: "CONTENTS", want: "replaced"},
+		{name: "size differs", existing: Asset{Size: 1}, want: "replaced"},
+		{name: "label", contents: "contents", label: "Linux", want: "label updated"},
+	}
+	for _, tt := range tests {
+		existing := tt.existing
+		existing.Id, existing.Name, existing.State = 1, "a.zip", "uploaded"
+		if existing.Size == 0 {
+			existing.Size = uint64(len("contents"))
+		}
+		f, rel := newFakeAssets(t, existing)
+		f.contents[1] = tt.contents
+		rel.TagName = "v1"
+
+		file := &manifestFile{uploadFile: uploadFile{Path: tempFile(t, "a.zip", "contents").Name(), Name: "a.zip"}, Label: tt.label}
+		got, err := applyAsset("o", "r", "", "token", rel, []Asset{existing}, file, RetryPolicy{Attempts: 1})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		assets := f.listAssets()
+		if len(assets) != 1 || assets[0].Name != "a.zip" || assets[0].Label != tt.label {
+			t.Errorf("%s: assets afterwards %+v", tt.name, assets)
+		} else if tt.want == "replaced" && f.contents[assets[0].Id] != "contents" {
+			t.Errorf("%s: asset has contents %q after replacing it", tt.name, f.contents[assets[0].Id])
+		}
+	}
+}
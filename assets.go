@@ -2,33 +2,11 @@ package main
 
 import (
 	"fmt"
-	"net/http"
-	"time"
 
 	"github.com/github-release/github-release/github"
 )
 
-const (
-	// GET /repos/:owner/:repo/releases/assets/:id
-	// DELETE /repos/:owner/:repo/releases/assets/:id
-	ASSET_URI = "/repos/%s/%s/releases/assets/%d"
-
-	// API: https://developer.github.com/v3/repos/releases/#list-assets-for-a-release
-	// GET /repos/:owner/:repo/releases/:id/assets
-	ASSET_RELEASE_LIST_URI = "/repos/%s/%s/releases/%d/assets"
-)
-
-type Asset struct {
-	Url         string    `json:"url"`
-	Id          int       `json:"id"`
-	Name        string    `json:"name"`
-	ContentType string    `json:"content_type"`
-	State       string    `json:"state"`
-	Size        uint64    `json:"size"`
-	Downloads   uint64    `json:"download_count"`
-	Created     time.Time `json:"created_at"`
-	Published   time.Time `json:"published_at"`
-}
+type Asset = github.Asset
 
 // findAsset returns the asset if an asset with name can be found in assets,
 // otherwise returns nil.
@@ -41,18 +19,56 @@ func findAsset(assets []Asset, name string) *Asset {
 	return nil
 }
 
-// Delete sends a HTTP DELETE request for the given asset to Github. Returns
-// nil if the asset was deleted OR there was nothing to delete.
-func (a *Asset) Delete(user, repo, token string) error {
-	URL := nvls(EnvApiEndpoint, github.DefaultBaseURL) +
-		fmt.Sprintf(ASSET_URI, user, repo, a.Id)
-	resp, err := github.DoAuthRequest("DELETE", URL, "application/json", token, nil, nil)
-	if err != nil {
-		return fmt.Errorf("failed to delete asset %s (ID: %d), HTTP error: %b", a.Name, a.Id, err)
+// ReleaseAssets returns all assets of the release with the given id,
+// including incomplete uploads. The assets embedded in a Release omit
+// those, see issue #26.
+func ReleaseAssets(user, repo, authUser, token string, id int) ([]Asset, error) {
+	return newClient(authUser, token).ListAssets(user, repo, id)
+}
+
+// assetNotFoundError is returned if a release has no asset of the name.
+type assetNotFoundError struct {
+	name string
+}
+
+func (e assetNotFoundError) Error() string {
+	return fmt.Sprintf("could not find asset named %s", e.name)
+}
+
+// findReleaseAsset returns the asset called name of the release with the
+// given id, including incomplete uploads, or nil if there is none.
+func findReleaseAsset(user, repo, authUser, token string, id int, name string) (*Asset, error) {
+	for asset, err := range newClient(authUser, token).Assets(user, repo, id, github.PageOptions{}) {
+		if err != nil {
+			return nil, err
+		}
+		if asset.Name == name {
+			return &asset, nil
+		}
+	}
+	return nil, nil
+}
+
+// deleteAsset deletes the asset a on Github.
+func deleteAsset(user, repo, token string, a *Asset) error {
+	if err := newClient("", token).DeleteAsset(user, repo, a.Id); err != nil {
+		return fmt.Errorf("failed to delete asset %s (ID: %d), %w", a.Name, a.Id, err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to delete asset %s (ID: %d), status: %s", a.Name, a.Id, resp.Status)
+	return nil
+}
+
+// renameAsset changes the name of the asset on Github, a is updated to
+// reflect the new name on success.
+func renameAsset(user, repo, token string, a *Asset, name string) error {
+	return editAsset(user, repo, token, a, name, a.Label)
+}
+
+// editAsset changes the name and label of the asset on Github, a is
+// updated to reflect them on success.
+func editAsset(user, repo, token string, a *Asset, name, label string) error {
+	if _, err := newClient("", token).UpdateAsset(user, repo, a.Id, name, label); err != nil {
+		return fmt.Errorf("failed to edit asset %s (ID: %d), %w", a.Name, a.Id, err)
 	}
+	a.Name, a.Label = name, label
 	return nil
 }
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumManifestName is the name of the manifest generated by the
+// checksums command and upload --checksums.
+const checksumManifestName = "SHA256SUMS"
+
+// checksumManifests are the names of release assets that conventionally
+// list the checksums of all other assets, in order of preference.
+var checksumManifests = []string{
+	"SHA256SUMS",
+	"SHA512SUMS",
+	"sha256sums.txt",
+	"sha512sums.txt",
+	"checksums.txt",
+}
+
+// checksumAssets returns the assets of a release that may hold the checksum
+// of the asset called name, most specific first: <name>.sha256 and friends,
+// then the well-known manifests, then anything else that looks like one
+// (e.g. goreleaser's <project>_<version>_checksums.txt).
+func checksumAssets(assets []Asset, name string) []Asset {
+	var found []Asset
+	seen := make(map[int]bool)
+	add := func(a *Asset) {
+		if a != nil && !seen[a.Id] && a.Name != name {
+			seen[a.Id] = true
+			found = append(found, *a)
+		}
+	}
+	for _, ext := range []string{".sha256", ".sha512", ".sha256sum", ".sha512sum"} {
+		add(findAsset(assets, name+ext))
+	}
+	for _, manifest := range checksumManifests {
+		add(findAsset(assets, manifest))
+	}
+	for i := range assets {
+		if isChecksumManifest(assets[i].Name) {
+			add(&assets[i])
+		}
+	}
+	return found
+}
+
+// isChecksumManifest reports whether name looks like a file listing the
+// checksums of other files.
+func isChecksumManifest(name string) bool {
+	lower := strings.ToLower(name)
+	for _, suffix := range []string{"checksums.txt", "sha256sums", "sha512sums", "sha256sums.txt", "sha512sums.txt"} {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChecksumFile reports whether the asset called name holds checksums
+// rather than something that can be verified with them.
+func isChecksumFile(name string) bool {
+	if isChecksumManifest(name) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".sha256", ".sha512", ".sha256sum", ".sha512sum":
+		return true
+	}
+	return false
+}
+
+// parseChecksums parses the output of sha256sum/sha512sum (GNU or BSD
+// style) into a map of file name to lowercase hex digest. A file that holds
+// nothing but a digest is stored under the empty name.
+func parseChecksums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var sum, name string
+		if i := strings.Index(line, ") = "); i != -1 && strings.Contains(line[:i], " (") {
+			// BSD style: SHA256 (name) = digest
+			sum = line[i+len(") = "):]
+			name = line[strings.Index(line, " (")+2 : i]
+		} else {
+			fields := strings.SplitN(line, " ", 2)
+			sum = fields[0]
+			if len(fields) == 2 {
+				// GNU style: digest  name, or digest *name in binary mode.
+				name = strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+			}
+		}
+
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("malformed checksum line %q", line)
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums, scanner.Err()
+}
+
+// newChecksumHash returns a hash matching the length of the hex encoded
+// digest sum.
+func newChecksumHash(sum string) (hash.Hash, error) {
+	switch len(sum) {
+	case sha256.Size * 2:
+		return sha256.New(), nil
+	case sha512.Size * 2:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum %q, expected SHA-256 or SHA-512", sum)
+}
+
+// hashFile returns the hex encoded SHA-256 digest of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// releaseChecksums returns the SHA-256 digests of all complete assets of
+// rel, except the manifest itself. Digests in known (by asset name) are
+// trusted as is, as are the digests Github computes for new uploads;
+// everything else is downloaded and hashed.
+func releaseChecksums(user, repo, authUser, token string, rel *Release, known map[string]string) (map[string]string, error) {
+	assets, err := ReleaseAssets(user, repo, authUser, token, rel.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string)
+	for i := range assets {
+		asset := &assets[i]
+		if asset.Name == checksumManifestName || asset.State != "uploaded" {
+			continue
+		}
+		if sum, ok := known[asset.Name]; ok {
+			sums[asset.Name] = sum
+			continue
+		}
+		sum, err := assetChecksum(user, repo, rel.TagName, token, asset)
+		if err != nil {
+			return nil, err
+		}
+		sums[asset.Name] = sum
+	}
+	return sums, nil
+}
+
+// assetChecksum returns the hex encoded SHA-256 digest of asset, which is
+// attached to the release of tag. The digest Github reports is trusted;
+// assets uploaded before Github computed digests are downloaded and hashed.
+func assetChecksum(user, repo, tag, token string, asset *Asset) (string, error) {
+	if sum, ok := strings.CutPrefix(asset.Digest, "sha256:"); ok {
+		return sum, nil
+	}
+
+	vprintf("computing checksum of %s\n", asset.Name)
+	resp, err := fetchAsset(user, repo, tag, token, asset, 0)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("could not download %s: %w", asset.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// formatChecksums renders sums in the format of sha256sum, sorted by name.
+func formatChecksums(sums map[string]string) []byte {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", sums[name], name)
+	}
+	return buf.Bytes()
+}
+
+// uploadChecksums computes the checksums of all assets of rel and uploads
+// them as the checksum manifest, replacing the previous one.
+func uploadChecksums(user, repo, authUser, token string, rel *Release, known map[string]string, policy RetryPolicy) error {
+	sums, err := releaseChecksums(user, repo, authUser, token, rel, known)
+	if err != nil {
+		return fmt.Errorf("could not compute checksums: %w", err)
+	}
+
+	tmp, err := os.CreateTemp("", checksumManifestName+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := tmp.Write(formatChecksums(sums)); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	assets, err := ReleaseAssets(user, repo, authUser, token, rel.Id)
+	if err != nil {
+		return err
+	}
+	if old := findAsset(assets, checksumManifestName); old != nil {
+		if old.State == "new" {
+			if err := deleteAsset(user, repo, token, old); err != nil {
+				return fmt.Errorf("could not remove incomplete checksum manifest: %w", err)
+			}
+		} else {
+			_, err = replaceAsset(user, repo, authUser, token, rel, old, "", tmp, policy)
+			return err
+		}
+	}
+	_, err = uploadAsset(user, repo, authUser, token, rel, checksumManifestName, "", tmp, policy)
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	const (
+		sum256 = "d4e4877bac978b7952f0d544fc52ebff5411d351d129f1f056fa43f11da9af2b"
+		sum512 = "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"
+	)
+	input := "# comment\n" +
+		sum256 + "  gnu.tar.gz\n" +
+		strings.ToUpper(sum256) + " *binary.exe\n" +
+		"SHA512 (bsd.zip) = " + sum512 + "\n"
+
+	sums, err := parseChecksums(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"gnu.tar.gz": sum256,
+		"binary.exe": sum256,
+		"bsd.zip":    sum512,
+	}
+	if len(sums) != len(want) {
+		t.Fatalf("got %d checksums, want %d: %v", len(sums), len(want), sums)
+	}
+	for name, sum := range want {
+		if sums[name] != sum {
+			t.Errorf("checksum of %s: got %q, want %q", name, sums[name], sum)
+		}
+	}
+
+	if _, err := parseChecksums(strings.NewReader("not-a-digest  file\n")); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+}
+
+func TestChecksumAssets(t *testing.T) {
+	assets := []Asset{
+		{Id: 1, Name: "app.tar.gz"},
+		{Id: 2, Name: "app_1.0_checksums.txt"},
+		{Id: 3, Name: "SHA256SUMS"},
+		{Id: 4, Name: "app.tar.gz.sha256"},
+	}
+	var got []int
+	for _, a := range checksumAssets(assets, "app.tar.gz") {
+		got = append(got, a.Id)
+	}
+	if want := []int{4, 3, 2}; len(got) != len(want) || got[0] != 4 || got[1] != 3 || got[2] != 2 {
+		t.Errorf("got candidates %v, want %v", got, want)
+	}
+}
+
+func TestFormatChecksums(t *testing.T) {
+	got := string(formatChecksums(map[string]string{"b.zip": "bbbb", "a.tar.gz": "aaaa", "A.txt": "cccc"}))
+	want := "cccc  A.txt\naaaa  a.tar.gz\nbbbb  b.zip\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := formatChecksums(nil); len(got) != 0 {
+		t.Errorf("got %q for no checksums", got)
+	}
+}
+
+// sha256Hex returns the hex encoded SHA-256 digest of s.
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestReleaseChecksums(t *testing.T) {
+	f, rel := newFakeAssets(t,
+		Asset{Id: 1, Name: "digest.zip", State: "uploaded", Digest: "sha256:" + sha256Hex("digest")},
+		Asset{Id: 2, Name: "hashed.zip", State: "uploaded"},
+		Asset{Id: 3, Name: "known.zip", State: "uploaded", Digest: "sha256:" + sha256Hex("stale")},
+		Asset{Id: 4, Name: "other-digest.zip", State: "uploaded", Digest: "md5:0123"},
+		Asset{Id: 5, Name: "incomplete.zip", State: "new"},
+		Asset{Id: 6, Name: checksumManifestName, State: "uploaded"},
+	)
+	f.contents[2] = "hashed"
+	f.contents[4] = "other"
+
+	sums, err := releaseChecksums("o", "r", "", "token", rel, map[string]string{"known.zip": sha256Hex("known")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"digest.zip":       sha256Hex("digest"),
+		"hashed.zip":       sha256Hex("hashed"),
+		"known.zip":        sha256Hex("known"),
+		"other-digest.zip": sha256Hex("other"),
+	}
+	if len(sums) != len(want) {
+		t.Errorf("got checksums of %v, want %d", sums, len(want))
+	}
+	for name, sum := range want {
+		if sums[name] != sum {
+			t.Errorf("checksum of %s: got %q, want %q", name, sums[name], sum)
+		}
+	}
+	var downloads []string
+	for _, req := range f.requests {
+		if req != "GET" {
+			downloads = append(downloads, req)
+		}
+	}
+	sort.Strings(downloads)
+	if strings.Join(downloads, ",") != "GET 2,GET 4" {
+		t.Errorf("downloaded %q, want only the assets without a SHA-256 digest", downloads)
+	}
+
+	f.fail["GET 2"] = []int{http.StatusForbidden}
+	if _, err := releaseChecksums("o", "r", "", "token", rel, nil); err == nil {
+		t.Error("expected an error when an asset can't be downloaded")
+	}
+}
+
+func TestUploadChecksums(t *testing.T) {
+	a := Asset{Id: 1, Name: "a.zip", State: "uploaded", Digest: "sha256:" + sha256Hex("a")}
+	tests := []struct {
+		name     string
+		manifest *Asset // The checksum manifest already attached, if any.
+		wantReqs string // The requests made to change the manifest.
+	}{
+		{name: "new manifest", wantReqs: "POST SHA256SUMS"},
+		{name: "replaced manifest", manifest: &Asset{Id: 2, Name: checksumManifestName, Label: "Checksums", State: "uploaded"}, wantReqs: "POST SHA256SUMS.tmp-,DELETE 2,PATCH 100"},
+		{name: "incomplete manifest", manifest: &Asset{Id: 2, Name: checksumManifestName, State: "new"}, wantReqs: "DELETE 2,POST SHA256SUMS"},
+	}
+	for _, tt := range tests {
+		assets := []Asset{a}
+		if tt.manifest != nil {
+			assets = append(assets, *tt.manifest)
+		}
+		f, rel := newFakeAssets(t, assets...)
+		if err := uploadChecksums("o", "r", "", "token", rel, map[string]string{"b.zip": sha256Hex("b")}, RetryPolicy{Attempts: 1}); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		var reqs []string
+		for _, req := range f.requests {
+			if i := strings.Index(req, ".tmp-"); i != -1 {
+				req = req[:i+len(".tmp-")]
+			}
+			if req != "GET" {
+				reqs = append(reqs, req)
+			}
+		}
+		if got := strings.Join(reqs, ","); got != tt.wantReqs {
+			t.Errorf("%s: requests %s, want %s", tt.name, got, tt.wantReqs)
+		}
+		manifest := findAsset(f.listAssets(), checksumManifestName)
+		if manifest == nil {
+			t.Errorf("%s: no manifest uploaded, assets are %q", tt.name, f.names())
+			continue
+		}
+		if tt.manifest != nil && manifest.Label != tt.manifest.Label {
+			t.Errorf("%s: manifest label %q, want %q", tt.name, manifest.Label, tt.manifest.Label)
+		}
+		want := sha256Hex("a") + "  a.zip\n"
+		if got := f.contents[manifest.Id]; got != want {
+			t.Errorf("%s: manifest\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
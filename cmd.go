@@ -1,16 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 
+	"github.com/dustin/go-humanize"
 	"github.com/github-release/github-release/github"
 )
 
@@ -18,28 +18,49 @@ func infocmd(opt Options) error {
 	user := nvls(opt.Info.User, EnvUser)
 	authUser := nvls(opt.Info.AuthUser, EnvAuthUser)
 	repo := nvls(opt.Info.Repo, EnvRepo)
-	token := nvls(opt.Info.Token, EnvToken)
+	token := securityToken(opt.Info.Token)
 	tag := opt.Info.Tag
 
 	if user == "" || repo == "" {
 		return fmt.Errorf("user and repo need to be passed as arguments")
 	}
 
-	// Find regular git tags.
-	foundTags, err := Tags(user, repo, authUser, token)
-	if err != nil {
-		return fmt.Errorf("could not fetch tags, %v", err)
-	}
-	if len(foundTags) == 0 {
-		return fmt.Errorf("no tags available for %v/%v", user, repo)
+	var latest *Release
+	if opt.Info.Latest || opt.Info.TagConstraint != "" {
+		latestPolicy, err := newLatestPolicy(opt.Info.IncludePrereleases,
+			opt.Info.Semver, opt.Info.TagConstraint)
+		if err != nil {
+			return err
+		}
+		latest, err = LatestRelease(user, repo, authUser, token, latestPolicy)
+		if err != nil {
+			return err
+		}
+		tag = latest.TagName
 	}
 
-	tags := foundTags[:0]
-	for _, t := range foundTags {
-		// If the user only requested one tag, filter out the rest.
+	// Find regular git tags. If the user only requested one tag, stop
+	// looking once it is found.
+	tags := []Tag{}
+	found := false
+	limit := opt.Info.Limit
+	if tag != "" {
+		limit = 0
+	}
+	for t, err := range Tags(user, repo, authUser, token, github.PageOptions{Limit: limit}) {
+		if err != nil {
+			return fmt.Errorf("could not fetch tags, %w", err)
+		}
+		found = true
 		if tag == "" || t.Name == tag {
 			tags = append(tags, t)
 		}
+		if t.Name == tag {
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("no tags available for %v/%v", user, repo)
 	}
 
 	renderer := renderInfoText
@@ -50,10 +71,13 @@ func infocmd(opt Options) error {
 
 	// List releases + assets.
 	var releases []Release
-	if tag == "" {
+	if latest != nil {
+		releases = []Release{*latest}
+	} else if tag == "" {
 		// Get all releases.
 		vprintf("%v/%v: getting information for all releases\n", user, repo)
-		releases, err = Releases(user, repo, authUser, token)
+		var err error
+		releases, err = Releases(user, repo, authUser, token, opt.Info.Limit)
 		if err != nil {
 			return err
 		}
@@ -78,7 +102,7 @@ func renderInfoText(tags []Tag, releases []Release) error {
 
 	fmt.Println("releases:")
 	for _, release := range releases {
-		fmt.Println("-", &release)
+		fmt.Println("-", formatRelease(&release))
 	}
 
 	return nil
@@ -102,18 +126,28 @@ func uploadcmd(opt Options) error {
 	user := nvls(opt.Upload.User, EnvUser)
 	authUser := nvls(opt.Upload.AuthUser, EnvAuthUser)
 	repo := nvls(opt.Upload.Repo, EnvRepo)
-	token := nvls(opt.Upload.Token, EnvToken)
+	token := securityToken(opt.Upload.Token)
 	tag := opt.Upload.Tag
 	name := opt.Upload.Name
 	label := opt.Upload.Label
-	file := opt.Upload.File
+	policy := DefaultRetryPolicy
+	policy.Attempts = opt.Upload.Attempts
+	policy.BaseDelay = opt.Upload.RetryDelay
 
 	vprintln("uploading...")
 
-	if file == nil {
-		return fmt.Errorf("provided file was not valid")
+	if opt.Upload.StdinLimit != "" {
+		limit, err := humanize.ParseBytes(opt.Upload.StdinLimit)
+		if err != nil {
+			return fmt.Errorf("invalid stdin limit %q: %v", opt.Upload.StdinLimit, err)
+		}
+		github.SpoolLimit = int64(limit)
+	}
+
+	files, err := expandUploadFiles(append(opt.Upload.Files, opt.Upload.Remainder...), name)
+	if err != nil {
+		return err
 	}
-	defer file.Close()
 
 	if err := ValidateCredentials(user, repo, token, tag); err != nil {
 		return err
@@ -131,89 +165,102 @@ func uploadcmd(opt Options) error {
 	// Reason: the assets in the Release struct do not contain incomplete
 	// uploads (which regrettably happen often using the Github API). See
 	// issue #26.
-	var assets []Asset
-	client := github.NewClient(authUser, token, nil)
-	client.SetBaseURL(EnvApiEndpoint)
-	err = client.Get(fmt.Sprintf(ASSET_RELEASE_LIST_URI, user, repo, rel.Id), &assets)
+	assets, err := ReleaseAssets(user, repo, authUser, token, rel.Id)
 	if err != nil {
 		return err
 	}
 
-	// Incomplete (failed) uploads will have their state set to new. These
-	// assets are (AFAIK) useless in all cases. The only thing they will do
-	// is prevent the upload of another asset of the same name. To work
-	// around this GH API weirdness, let's just delete assets if:
-	//
-	// 1. Their state is new.
-	// 2. The user explicitly asked to delete/replace the asset with -R.
-	if asset := findAsset(assets, name); asset != nil &&
-		(asset.State == "new" || opt.Upload.Replace) {
-		vprintf("asset (id: %d) already existed in state %s: removing...\n", asset.Id, asset.Name)
-		if err := asset.Delete(user, repo, token); err != nil {
-			return fmt.Errorf("could not replace asset: %v", err)
-		}
+	err = uploadFiles(user, repo, authUser, token, rel, assets, files, label,
+		opt.Upload.Replace, opt.Upload.Parallel, policy)
+	if len(files) == 1 {
+		// Keep the output of single file uploads as terse as it always was.
+		err = files[0].Err
+	} else if !opt.Quiet {
+		printUploadSummary(os.Stderr, files)
+	}
+	if err != nil || !opt.Upload.Checksums {
+		return err
 	}
 
-	v := url.Values{}
-	v.Set("name", name)
-	if label != "" {
-		v.Set("label", label)
+	// The files were just read from disk, so hash them locally instead of
+	// downloading them again.
+	known := make(map[string]string)
+	for _, f := range files {
+		if f.Path == "-" {
+			continue
+		}
+		if known[f.Name], err = hashFile(f.Path); err != nil {
+			return err
+		}
 	}
+	vprintf("updating %s\n", checksumManifestName)
+	return uploadChecksums(user, repo, authUser, token, rel, known, policy)
+}
 
-	url := rel.CleanUploadUrl() + "?" + v.Encode()
+func checksumscmd(opt Options) error {
+	user := nvls(opt.Checksums.User, EnvUser)
+	authUser := nvls(opt.Checksums.AuthUser, EnvAuthUser)
+	repo := nvls(opt.Checksums.Repo, EnvRepo)
+	token := securityToken(opt.Checksums.Token)
+	tag := opt.Checksums.Tag
+
+	vprintln("computing checksums...")
+
+	if err := ValidateCredentials(user, repo, token, tag); err != nil {
+		return err
+	}
 
-	resp, err := github.DoAuthRequest("POST", url, "application/octet-stream",
-		token, nil, file)
+	rel, err := ReleaseOfTag(user, repo, tag, authUser, token)
 	if err != nil {
-		return fmt.Errorf("can't create upload request to %v, %v", url, err)
+		return err
 	}
-	defer resp.Body.Close()
-	vprintln("RESPONSE:", resp)
-
-	var r io.Reader = resp.Body
-	if VERBOSITY != 0 {
-		r = io.TeeReader(r, os.Stderr)
-	}
-	var asset *Asset
-	// For HTTP status 201 and 502, Github will return a JSON encoding of
-	// the (partially) created asset.
-	if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusCreated {
-		vprintf("ASSET: ")
-		asset = new(Asset)
-		if err := json.NewDecoder(r).Decode(&asset); err != nil {
-			return fmt.Errorf("upload failed (%s), could not unmarshal asset (err: %v)", resp.Status, err)
-		}
-	} else {
-		vprintf("BODY: ")
-		if msg, err := ToMessage(r); err == nil {
-			return fmt.Errorf("could not upload, status code (%s), %v",
-				resp.Status, msg)
+
+	return uploadChecksums(user, repo, authUser, token, rel, nil, DefaultRetryPolicy)
+}
+
+func applycmd(opt Options) error {
+	f := os.Stdin
+	if opt.Apply.File != "-" {
+		var err error
+		if f, err = os.Open(opt.Apply.File); err != nil {
+			return err
 		}
-		return fmt.Errorf("could not upload, status code (%s)", resp.Status)
+		defer f.Close()
+	}
+	m, err := readManifest(f)
+	if err != nil {
+		return err
 	}
+	m.Prune = m.Prune || opt.Apply.Prune
 
-	if resp.StatusCode == http.StatusBadGateway {
-		// 502 means the upload failed, but GitHub still retains metadata
-		// (an asset in state "new"). Attempt to delete that now since it
-		// would clutter the list of release assets.
-		vprintf("asset (id: %d) failed to upload, it's now in state %s: removing...\n", asset.Id, asset.Name)
-		if err := asset.Delete(user, repo, token); err != nil {
-			return fmt.Errorf("upload failed (%s), could not delete partially uploaded asset (ID: %d, err: %v) in order to cleanly reset GH API state, please try again", resp.Status, asset.Id, err)
-		}
-		return fmt.Errorf("could not upload, status code (%s)", resp.Status)
+	// Flags override the manifest, which overrides the environment.
+	user := nvls(opt.Apply.User, m.User, EnvUser)
+	authUser := nvls(opt.Apply.AuthUser, EnvAuthUser)
+	repo := nvls(opt.Apply.Repo, m.Repo, EnvRepo)
+	token := securityToken(opt.Apply.Token)
+
+	vprintln("applying...")
+
+	if err := ValidateCredentials(user, repo, token, m.Tag); err != nil {
+		return err
 	}
 
-	return nil
+	report := func(format string, a ...interface{}) {
+		if !opt.Quiet {
+			fmt.Fprintf(os.Stderr, format+"\n", a...)
+		}
+	}
+	return applyManifest(user, repo, authUser, token, m, DefaultRetryPolicy, report)
 }
 
 func downloadcmd(opt Options) error {
 	user := nvls(opt.Download.User, EnvUser)
 	authUser := nvls(opt.Download.AuthUser, EnvAuthUser)
 	repo := nvls(opt.Download.Repo, EnvRepo)
-	token := nvls(opt.Download.Token, EnvToken)
+	token := securityToken(opt.Download.Token)
 	tag := opt.Download.Tag
 	name := opt.Download.Name
-	latest := opt.Download.Latest
+	latest := opt.Download.Latest || opt.Download.TagConstraint != ""
 
 	vprintln("downloading...")
 
@@ -225,7 +272,13 @@ func downloadcmd(opt Options) error {
 	var rel *Release
 	var err error
 	if latest {
-		rel, err = LatestRelease(user, repo, authUser, token)
+		var latestPolicy LatestPolicy
+		latestPolicy, err = newLatestPolicy(opt.Download.IncludePrereleases,
+			opt.Download.Semver, opt.Download.TagConstraint)
+		if err != nil {
+			return err
+		}
+		rel, err = LatestRelease(user, repo, authUser, token, latestPolicy)
 	} else {
 		rel, err = ReleaseOfTag(user, repo, tag, authUser, token)
 	}
@@ -233,49 +286,84 @@ func downloadcmd(opt Options) error {
 		return err
 	}
 
+	policy := DefaultRetryPolicy
+	policy.Attempts = opt.Download.Attempts
+
+	if name == "" || opt.Download.OutputDir != "" {
+		assets, err := selectAssets(rel.Assets, name, opt.Download.Pattern)
+		if err != nil {
+			return err
+		}
+		files := make([]*downloadFile, len(assets))
+		var verified []string
+		for i := range assets {
+			files[i] = &downloadFile{Asset: &assets[i], Dest: filepath.Join(opt.Download.OutputDir, assets[i].Name)}
+			if !isChecksumFile(assets[i].Name) {
+				verified = append(verified, assets[i].Name)
+			}
+		}
+		// Read the checksum files only once, not for every asset.
+		var sums checksumFiles
+		if opt.Download.Verify {
+			if sums, err = loadChecksumFiles(user, repo, rel.TagName, token, rel.Assets, verified); err != nil {
+				return err
+			}
+		}
+		err = downloadFiles(user, repo, token, rel, files, sums,
+			opt.Download.Parallel, policy)
+		if len(files) == 1 {
+			return files[0].Err
+		}
+		if !opt.Quiet {
+			printDownloadSummary(os.Stderr, files)
+		}
+		return err
+	}
+
 	asset := findAsset(rel.Assets, name)
 	if asset == nil {
-		return fmt.Errorf("coud not find asset named %s", name)
+		return assetNotFoundError{name}
 	}
 
-	var resp *http.Response
-	if token == "" {
-		// Use the regular github.com site if we don't have a token.
-		resp, err = http.Get("https://github.com" + fmt.Sprintf("/%s/%s/releases/download/%s/%s", user, repo, tag, name))
-	} else {
-		url := nvls(EnvApiEndpoint, github.DefaultBaseURL) + fmt.Sprintf(ASSET_URI, user, repo, asset.Id)
-		resp, err = github.DoAuthRequest("GET", url, "", token, map[string]string{
-			"Accept": "application/octet-stream",
-		}, nil)
+	var sum string
+	if opt.Download.Verify {
+		sums, err := loadChecksumFiles(user, repo, rel.TagName, token, rel.Assets, []string{name})
+		if err != nil {
+			return err
+		}
+		if sum, err = expectedChecksum(sums, rel.Assets, name); err != nil {
+			return err
+		}
+		vprintf("expecting checksum %s for %s\n", sum, name)
 	}
-	if err != nil {
-		return fmt.Errorf("could not fetch releases, %v", err)
+
+	// If stdout is a char device, assume it's a TTY (terminal). In this
+	// case, don't pipe the asset to stdout, but create it as a file in the
+	// current working folder.
+	if isCharDevice(os.Stdout) {
+		return downloadToFile(user, repo, rel.TagName, token, asset, name, sum, policy)
 	}
-	defer resp.Body.Close()
 
-	vprintln("GET", resp.Request.URL, "->", resp)
+	if sum != "" {
+		// Don't pipe anything into the next program before it has been
+		// verified, go through a temporary file instead.
+		return downloadToStdout(user, repo, rel.TagName, token, asset, sum, policy)
+	}
 
-	contentLength, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	resp, err := fetchAsset(user, repo, rel.TagName, token, asset, 0)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("github did not respond with 200 OK but with %v", resp.Status)
-	}
-
-	out := os.Stdout // Pipe the asset to stdout by default.
-	if isCharDevice(out) {
-		// If stdout is a char device, assume it's a TTY (terminal). In this
-		// case, don't pipe th easset to stdout, but create it as a file in
-		// the current working folder.
-		if out, err = os.Create(name); err != nil {
-			return fmt.Errorf("could not create file %s", name)
-		}
-		defer out.Close()
+	contentLength, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return err
 	}
 
-	return mustCopyN(out, resp.Body, contentLength)
+	progress := newProgressReader(resp.Body, name, 0, contentLength)
+	defer progress.Close()
+	return mustCopyN(os.Stdout, progress, contentLength)
 }
 
 // mustCopyN attempts to copy exactly N bytes, if this fails, an error is
@@ -306,16 +394,19 @@ func ValidateCredentials(user, repo, token, tag string) error {
 		return err
 	}
 	if token == "" {
-		return fmt.Errorf("empty token")
+		return errNoToken
 	}
 	return nil
 }
 
+// errNoToken is returned by ValidateCredentials if there is no token.
+var errNoToken = errors.New("empty token")
+
 func releasecmd(opt Options) error {
 	cmdopt := opt.Release
 	user := nvls(cmdopt.User, EnvUser)
 	repo := nvls(cmdopt.Repo, EnvRepo)
-	token := nvls(cmdopt.Token, EnvToken)
+	token := securityToken(cmdopt.Token)
 	tag := cmdopt.Tag
 	name := cmdopt.Name
 	desc := cmdopt.Desc
@@ -353,45 +444,8 @@ func releasecmd(opt Options) error {
 		GenerateReleaseNotes: generateReleaseNotes,
 	}
 
-	/* encode params as json */
-	payload, err := json.Marshal(params)
-	if err != nil {
-		return fmt.Errorf("can't encode release creation params, %v", err)
-	}
-	reader := bytes.NewReader(payload)
-
-	// NB: Github appears to ignore the user here - the only thing that seems to
-	// matter is that the token is valid.
-	client := github.NewClient(user, token, nil)
-	client.SetBaseURL(EnvApiEndpoint)
-	req, err := client.NewRequest("POST", fmt.Sprintf("/repos/%s/%s/releases", user, repo), reader)
-	if err != nil {
-		return fmt.Errorf("while submitting %v: %w", string(payload), err)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("while submitting %v: %w", string(payload), err)
-	}
-	defer resp.Body.Close()
-
-	vprintln("RESPONSE:", resp)
-	if resp.StatusCode != http.StatusCreated {
-		if resp.StatusCode == 422 {
-			return fmt.Errorf("github returned %v (this is probably because the release already exists)",
-				resp.Status)
-		}
-		return fmt.Errorf("github returned %v", resp.Status)
-	}
-
-	if VERBOSITY != 0 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("error while reading response, %v", err)
-		}
-		vprintln("BODY:", string(body))
-	}
-
-	return nil
+	_, err := CreateRelease(user, repo, token, params)
+	return err
 }
 
 func editcmd(opt Options) error {
@@ -399,7 +453,7 @@ func editcmd(opt Options) error {
 	user := nvls(cmdopt.User, EnvUser)
 	authUser := nvls(cmdopt.AuthUser, EnvAuthUser)
 	repo := nvls(cmdopt.Repo, EnvRepo)
-	token := nvls(cmdopt.Token, EnvToken)
+	token := securityToken(cmdopt.Token)
 	tag := cmdopt.Tag
 	name := nvls(cmdopt.Name, tag)
 	desc := nvls(cmdopt.Desc, tag)
@@ -437,43 +491,14 @@ func editcmd(opt Options) error {
 		Prerelease: prerelease,
 	}
 
-	/* encode the parameters as JSON, as required by the github API */
-	payload, err := json.Marshal(params)
-	if err != nil {
-		return fmt.Errorf("can't encode release creation params, %v", err)
-	}
-
-	URL := nvls(EnvApiEndpoint, github.DefaultBaseURL) + fmt.Sprintf("/repos/%s/%s/releases/%d", user, repo, id)
-	resp, err := github.DoAuthRequest("PATCH", URL, "application/json", token, nil, bytes.NewReader(payload))
-	if err != nil {
-		return fmt.Errorf("while submitting %v, %v", string(payload), err)
-	}
-	defer resp.Body.Close()
-
-	vprintln("RESPONSE:", resp)
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == 422 {
-			return fmt.Errorf("github returned %v (this is probably because the release already exists)",
-				resp.Status)
-		}
-		return fmt.Errorf("github returned unexpected status code %v", resp.Status)
-	}
-
-	if VERBOSITY != 0 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("error while reading response, %v", err)
-		}
-		vprintln("BODY:", string(body))
-	}
-
-	return nil
+	_, err = EditRelease(user, repo, token, id, params)
+	return err
 }
 
 func deletecmd(opt Options) error {
 	user, repo, token, tag := nvls(opt.Delete.User, EnvUser),
 		nvls(opt.Delete.Repo, EnvRepo),
-		nvls(opt.Delete.Token, EnvToken),
+		securityToken(opt.Delete.Token),
 		opt.Delete.Tag
 	authUser := nvls(opt.Delete.AuthUser, EnvAuthUser)
 	vprintln("deleting...")
@@ -485,18 +510,11 @@ func deletecmd(opt Options) error {
 
 	vprintf("release %v has id %v\n", tag, id)
 
-	baseURL := nvls(EnvApiEndpoint, github.DefaultBaseURL)
-	resp, err := github.DoAuthRequest("DELETE", baseURL+fmt.Sprintf("/repos/%s/%s/releases/%d",
-		user, repo, id), "application/json", token, nil, nil)
-	if err != nil {
-		return fmt.Errorf("release deletion failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("could not delete the release corresponding to tag %s on repo %s/%s",
-			tag, user, repo)
+	if err := newClient("", token).DeleteRelease(user, repo, id); err != nil {
+		return fmt.Errorf("could not delete the release corresponding to tag %s on repo %s/%s: %w",
+			tag, user, repo, err)
 	}
+	forgetReleaseId(user, repo, tag)
 
 	return nil
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// The config file of the user, relative to os.UserConfigDir(), and the
+// repository-local one, looked for in the working directory and its
+// parents up to the root of the git repository.
+const (
+	userConfigPath  = "github-release/config.toml"
+	localConfigName = ".github-release.toml"
+)
+
+// Profile holds the settings for one Github installation and account. Of
+// the token sources, the first one set in the order below is used.
+type Profile struct {
+	API      string `toml:"api"`    // API endpoint, like $GITHUB_API.
+	Upload   string `toml:"upload"` // Endpoint for asset uploads.
+	User     string `toml:"user"`
+	AuthUser string `toml:"auth_user"`
+	Repo     string `toml:"repo"`
+
+	Token        string `toml:"token"`
+	TokenEnv     string `toml:"token_env"`     // Name of an environment variable.
+	TokenFile    string `toml:"token_file"`    // Path of a file holding the token.
+	TokenCommand string `toml:"token_command"` // Shell command printing the token.
+
+	// Authenticate as an installation of a Github App instead.
+	AppID             int64  `toml:"app_id"`
+	AppInstallationID int64  `toml:"app_installation_id"`
+	AppKeyFile        string `toml:"app_key_file"` // PEM encoded private key.
+
+	dir string // Directory of the config file, for relative paths.
+}
+
+// Config is the content of a config file:
+//
+//	# Settings outside of a profile apply to all of them.
+//	user = "aktau"
+//	# The profile to use when --profile isn't given.
+//	profile = "github"
+//
+//	[profiles.github]
+//	token_env = "GITHUB_TOKEN"
+//
+//	[profiles.enterprise]
+//	api = "https://github.example.com/api/v3"
+//	upload = "https://github.example.com/api/uploads"
+//	token_command = "pass show github.example.com"
+//	user = "infra"
+type Config struct {
+	Profile
+	DefaultProfile string             `toml:"profile"`
+	Profiles       map[string]Profile `toml:"profiles"`
+}
+
+// hasToken reports whether p sets any token source.
+func (p *Profile) hasToken() bool {
+	return p.Token != "" || p.TokenEnv != "" || p.TokenFile != "" || p.TokenCommand != "" || p.AppID != 0
+}
+
+// merge fills in the settings p leaves empty from o. Token sources are
+// taken together, so that a profile with its own token source doesn't
+// inherit a token it would prefer.
+func (p *Profile) merge(o Profile) {
+	p.API = nvls(p.API, o.API)
+	p.Upload = nvls(p.Upload, o.Upload)
+	p.User = nvls(p.User, o.User)
+	p.AuthUser = nvls(p.AuthUser, o.AuthUser)
+	p.Repo = nvls(p.Repo, o.Repo)
+	if !p.hasToken() {
+		p.Token, p.TokenEnv, p.TokenFile, p.TokenCommand, p.dir =
+			o.Token, o.TokenEnv, o.TokenFile, o.TokenCommand, o.dir
+		p.AppID, p.AppInstallationID, p.AppKeyFile =
+			o.AppID, o.AppInstallationID, o.AppKeyFile
+	}
+}
+
+// resolveToken obtains the token from the configured source, if any.
+func (p *Profile) resolveToken() (string, error) {
+	switch {
+	case p.Token != "":
+		return p.Token, nil
+	case p.TokenEnv != "":
+		return os.Getenv(p.TokenEnv), nil
+	case p.TokenFile != "":
+		return readTokenFile(p.path(p.TokenFile))
+	case p.TokenCommand != "":
+		return runTokenCommand(p.TokenCommand, p.dir)
+	case p.AppID != 0:
+		return appToken(p.AppID, p.AppInstallationID, p.path(p.AppKeyFile))
+	}
+	return "", nil
+}
+
+// path resolves a path from the config file, which may start with ~/ or
+// be relative to the directory of the file.
+func (p *Profile) path(name string) string {
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(p.dir, name)
+}
+
+// readConfig parses the config file at path. A missing file is an empty
+// config.
+func readConfig(path string) (*Config, error) {
+	var c Config
+	md, err := toml.DecodeFile(path, &c)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %v", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+	}
+
+	c.dir = filepath.Dir(path)
+	for name, p := range c.Profiles {
+		p.dir = c.dir
+		c.Profiles[name] = p
+	}
+	return &c, nil
+}
+
+// checkLocal makes sure the repository-local config c doesn't tell us
+// where to send the token, or how to obtain it: a repository that was just
+// cloned shouldn't be able to do either.
+func (c *Config) checkLocal(path string) error {
+	profiles := []Profile{c.Profile}
+	for _, p := range c.Profiles {
+		profiles = append(profiles, p)
+	}
+	for _, p := range profiles {
+		if p.API != "" || p.Upload != "" || p.hasToken() {
+			return fmt.Errorf("%s: endpoints and tokens can only be configured in %s", path, userConfigPath)
+		}
+	}
+	return nil
+}
+
+// findLocalConfig returns the path of the repository-local config file
+// that applies to the working directory, or "" if there is none.
+func findLocalConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, localConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "" // Don't look beyond the repository.
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadProfile reads the config files and returns the settings of the
+// profile called name, or of the default profile if name is empty. The
+// second return value reports whether name was given, as opposed to the
+// profile being picked by a config file.
+func loadProfile(name string) (*Profile, bool, error) {
+	user := &Config{}
+	userPath := ""
+	if dir, err := os.UserConfigDir(); err == nil {
+		userPath = filepath.Join(dir, userConfigPath)
+		if user, err = readConfig(userPath); err != nil {
+			return nil, false, err
+		}
+	}
+	local := &Config{}
+	if localPath := findLocalConfig(); localPath != "" {
+		var err error
+		if local, err = readConfig(localPath); err != nil {
+			return nil, false, err
+		}
+		if err := local.checkLocal(localPath); err != nil {
+			return nil, false, err
+		}
+	}
+
+	named := name != ""
+	name = nvls(name, local.DefaultProfile, user.DefaultProfile)
+	var p Profile
+	if name != "" {
+		up, uok := user.Profiles[name]
+		lp, lok := local.Profiles[name]
+		if !uok && !lok {
+			return nil, false, fmt.Errorf("unknown profile %q, %s defines: %s",
+				name, nvls(userPath, userConfigPath), strings.Join(profileNames(user), ", "))
+		}
+		p = lp
+		p.merge(up)
+	}
+	p.merge(local.Profile)
+	p.merge(user.Profile)
+	return &p, named, nil
+}
+
+func profileNames(c *Config) []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile sets the defaults for all commands (EnvUser and friends)
+// from the config files. Settings of the profile called name (from
+// --profile or $GITHUB_RELEASE_PROFILE) take precedence over the
+// environment. Other settings, including those of a default profile picked
+// by a config file, only fill in what it leaves empty: a checked-in
+// .github-release.toml must not replace the credentials of the user.
+//
+// The token and the auth user are left to the caller, which gets the
+// profile and whether it was named to weigh them against the other
+// sources, see resolveToken and applyAuthUser.
+func applyProfile(name string) (*Profile, bool, error) {
+	p, named, err := loadProfile(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	set := func(dst *string, v string) {
+		if named {
+			*dst = nvls(v, *dst)
+		} else {
+			*dst = nvls(*dst, v)
+		}
+	}
+	set(&EnvApiEndpoint, p.API)
+	set(&EnvUploadEndpoint, p.Upload)
+	set(&EnvUser, p.User)
+	set(&EnvRepo, p.Repo)
+	return p, named, nil
+}
+
+// applyAuthUser sets EnvAuthUser, which defaults to the user wherever that
+// came from, so it has to be called once the user is known. The auth user
+// of profile is weighed like the other settings of applyProfile.
+func applyAuthUser(p *Profile, named bool) {
+	EnvAuthUser = nvls(os.Getenv("GITHUB_AUTH_USER"), EnvUser)
+	if named {
+		EnvAuthUser = nvls(p.AuthUser, EnvAuthUser)
+	} else {
+		EnvAuthUser = nvls(EnvAuthUser, p.AuthUser)
+	}
+}
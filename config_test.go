@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(home, userConfigPath), `
+user = "aktau"
+token_env = "GH_TOKEN"
+
+[profiles.enterprise]
+api = "https://ghe.example.com/api/v3"
+token_env = "GHE_TOKEN"
+`)
+	t.Setenv("GHE_TOKEN", "s3cr3t")
+
+	repo := filepath.Join(home, "repo")
+	write(filepath.Join(repo, ".git", "HEAD"), "")
+	write(filepath.Join(repo, localConfigName), `
+repo = "gofinance"
+[profiles.enterprise]
+user = "infra"
+`)
+	sub := filepath.Join(repo, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	p, named, err := loadProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if named || p.User != "aktau" || p.Repo != "gofinance" || p.TokenEnv != "GH_TOKEN" || p.API != "" {
+		t.Errorf("default profile = %+v (named: %v)", p, named)
+	}
+
+	p, named, err = loadProfile("enterprise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !named || p.User != "infra" || p.Repo != "gofinance" || p.API != "https://ghe.example.com/api/v3" {
+		t.Errorf("enterprise profile = %+v", p)
+	}
+	if p.TokenEnv != "GHE_TOKEN" {
+		t.Errorf("profile with its own token source inherited token_env %q", p.TokenEnv)
+	}
+	if token, err := p.resolveToken(); err != nil || token != "s3cr3t" {
+		t.Errorf("resolveToken() = %q, %v", token, err)
+	}
+
+	if _, _, err := loadProfile("nope"); err == nil {
+		t.Error("unknown profiles should be an error")
+	}
+
+	// A default profile picked by a config file doesn't count as named, so
+	// it can't replace the credentials in the environment.
+	write(filepath.Join(repo, localConfigName), `
+profile = "enterprise"
+[profiles.enterprise]
+user = "infra"
+`)
+	p, named, err = loadProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if named || p.User != "infra" || p.API != "https://ghe.example.com/api/v3" {
+		t.Errorf("default profile of the repository = %+v (named: %v)", p, named)
+	}
+
+	// The repository can't redirect the token elsewhere.
+	write(filepath.Join(repo, localConfigName), `api = "https://evil.example.com"`)
+	if _, _, err := loadProfile(""); err == nil {
+		t.Error("endpoints in the repository-local config should be rejected")
+	}
+	write(filepath.Join(repo, localConfigName), `tokn = "typo"`)
+	if _, _, err := loadProfile(""); err == nil {
+		t.Error("unknown settings should be rejected")
+	}
+}
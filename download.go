@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/github-release/github-release/github"
+)
+
+// fetchAsset starts downloading asset, which is attached to the release of
+// tag, from byte offset onwards. The caller is responsible for closing the
+// response body, which is either 200 OK or, for offset > 0, possibly 206
+// Partial Content. Errors that may go away by trying again are returned as
+// retryableError.
+func fetchAsset(user, repo, tag, token string, asset *Asset, offset int64) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	if token == "" {
+		// Use the regular github.com site if we don't have a token.
+		resp, err = github.NewClient("", "", nil).Download(GH_URL+fmt.Sprintf("/%s/%s/releases/download/%s/%s", user, repo, tag, asset.Name), offset)
+	} else {
+		resp, err = newClient("", token).DownloadAsset(user, repo, asset.Id, offset)
+	}
+	if err != nil {
+		if isTransient(err) {
+			return nil, retryableError{fmt.Errorf("could not fetch asset, %w", err)}
+		}
+		return nil, fmt.Errorf("could not fetch asset, %w", err)
+	}
+	return resp, nil
+}
+
+// checksumFiles holds the parsed checksum files of a release, by asset
+// name.
+type checksumFiles map[string]map[string]string
+
+// loadChecksumFiles downloads and parses the checksum files of the release
+// of tag that may hold the checksums of the assets called names, each of
+// them once however many assets it covers.
+func loadChecksumFiles(user, repo, tag, token string, assets []Asset, names []string) (checksumFiles, error) {
+	files := make(checksumFiles)
+	for _, name := range names {
+		for _, candidate := range checksumAssets(assets, name) {
+			if _, ok := files[candidate.Name]; ok {
+				continue
+			}
+			vprintf("reading checksum file %s\n", candidate.Name)
+			resp, err := fetchAsset(user, repo, tag, token, &candidate, 0)
+			if err != nil {
+				return nil, fmt.Errorf("could not fetch checksum file %s: %w", candidate.Name, err)
+			}
+			sums, err := parseChecksums(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("could not parse checksum file %s: %v", candidate.Name, err)
+			}
+			files[candidate.Name] = sums
+		}
+	}
+	return files, nil
+}
+
+// expectedChecksum looks for a checksum of the asset called name in files,
+// which holds the checksum files published alongside it (see
+// loadChecksumFiles), and returns it as a hex string.
+func expectedChecksum(files checksumFiles, assets []Asset, name string) (string, error) {
+	candidates := checksumAssets(assets, name)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("cannot verify %s: the release has no checksum file", name)
+	}
+
+	for _, candidate := range candidates {
+		vprintf("looking for the checksum of %s in %s\n", name, candidate.Name)
+		sums := files[candidate.Name]
+		for file, sum := range sums {
+			// Manifests sometimes list paths (./name, dist/name) rather
+			// than bare names.
+			if file == name || filepath.Base(file) == name {
+				return sum, nil
+			}
+		}
+		// A file dedicated to this asset (<name>.sha256) may list just the
+		// digest, or the digest of a file with a different local name.
+		if len(sums) == 1 && strings.HasPrefix(candidate.Name, name+".") {
+			for _, sum := range sums {
+				return sum, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot verify %s: not listed in any checksum file", name)
+}
+
+// downloadToFile downloads asset into the file dest. The data goes into
+// dest.part first, which is only renamed to dest once complete (and
+// verified against the hex digest sum, unless that is empty). A .part file
+// left behind by an interrupted download is resumed with a Range request,
+// provided dest.part.info says it holds the same version of the asset.
+func downloadToFile(user, repo, tag, token string, asset *Asset, dest, sum string, policy RetryPolicy) error {
+	part := dest + ".part"
+	info := part + ".info"
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not create file %s: %v", part, err)
+	}
+	defer f.Close()
+
+	if b, err := os.ReadFile(info); err != nil || string(b) != partInfo(asset) {
+		if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+			vprintf("%s is not from the current version of %s, starting over\n", part, asset.Name)
+		}
+		if _, err := truncate(f); err != nil {
+			return err
+		}
+		if err := os.WriteFile(info, []byte(partInfo(asset)), 0644); err != nil {
+			return fmt.Errorf("could not create file %s: %v", info, err)
+		}
+	}
+
+	err = policy.retry("download "+asset.Name, func(int) error {
+		return resumeDownload(user, repo, tag, token, asset, f)
+	})
+	if err != nil {
+		return err
+	}
+
+	if sum != "" {
+		if err := verifyFile(f, sum); err != nil {
+			// Don't resume from bad data next time.
+			f.Close()
+			os.Remove(part)
+			os.Remove(info)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return err
+	}
+	os.Remove(info)
+	return nil
+}
+
+// partInfo identifies the version of asset a .part file holds: replacing
+// an asset gives it a new id, editing it a new update time.
+func partInfo(asset *Asset) string {
+	return fmt.Sprintf("%d %s\n", asset.Id, asset.Updated.Format(time.RFC3339Nano))
+}
+
+// downloadToStdout downloads and verifies asset in a temporary file, then
+// copies it to stdout.
+func downloadToStdout(user, repo, tag, token string, asset *Asset, sum string, policy RetryPolicy) error {
+	dir, err := os.MkdirTemp("", "github-release-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "asset")
+	if err := downloadToFile(user, repo, tag, token, asset, path, sum, policy); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+// resumeDownload appends the part of asset that is missing from f.
+func resumeDownload(user, repo, tag, token string, asset *Asset, f *os.File) error {
+	size := int64(asset.Size)
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > size {
+		vprintf("%s is larger than the asset, starting over\n", f.Name())
+		if offset, err = truncate(f); err != nil {
+			return err
+		}
+	}
+	if offset > 0 && offset == size {
+		vprintf("%s is already complete\n", f.Name())
+		return nil
+	}
+	if offset > 0 {
+		vprintf("resuming download of %s at byte %d of %d\n", asset.Name, offset, size)
+	}
+
+	resp, err := fetchAsset(user, repo, tag, token, asset, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		vprintln("server does not support resuming, starting over")
+		if offset, err = truncate(f); err != nil {
+			return err
+		}
+	}
+
+	progress := newProgressReader(resp.Body, asset.Name, offset, size)
+	defer progress.Close()
+	n, err := io.Copy(f, progress)
+	if err != nil {
+		return retryableError{fmt.Errorf("download interrupted after %d bytes: %w", offset+n, err)}
+	}
+	if offset+n != size {
+		return retryableError{fmt.Errorf("data did not match asset size %d != %d", offset+n, size)}
+	}
+	return nil
+}
+
+// truncate empties f and rewinds it. It returns the new offset (zero) for
+// convenience.
+func truncate(f *os.File) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return f.Seek(0, io.SeekStart)
+}
+
+// verifyFile checks the contents of f against the hex digest sum.
+func verifyFile(f *os.File, sum string) error {
+	h, err := newChecksumHash(sum)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", sum, got)
+	}
+	vprintln("checksum verified:", sum)
+	return nil
+}
+
+// downloadFile is a single asset scheduled for download by the download
+// command.
+type downloadFile struct {
+	Asset *Asset
+	Dest  string // Path to download the asset to.
+
+	Err error // Set on failure.
+}
+
+// selectAssets returns the assets called name or, if name is empty, those
+// matching pattern: a glob, or a regular expression if it is enclosed in
+// slashes. An empty pattern selects everything.
+func selectAssets(assets []Asset, name, pattern string) ([]Asset, error) {
+	var match func(string) bool
+	switch {
+	case name != "":
+		match = func(s string) bool { return s == name }
+	case len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %v", pattern, err)
+		}
+		match = re.MatchString
+	case pattern != "":
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		match = func(s string) bool {
+			ok, _ := path.Match(pattern, s)
+			return ok
+		}
+	default:
+		match = func(string) bool { return true }
+	}
+
+	var selected []Asset
+	for _, asset := range assets {
+		if match(asset.Name) {
+			selected = append(selected, asset)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no assets matched %s", nvls(name, pattern, "(release has no assets)"))
+	}
+	return selected, nil
+}
+
+// downloadFiles downloads files using at most parallel concurrent
+// downloads, verifying them against the checksum files sums unless that is
+// nil. The outcome of each download is recorded in the downloadFile itself;
+// the returned error only summarizes how many downloads failed.
+func downloadFiles(user, repo, token string, rel *Release, files []*downloadFile, sums checksumFiles, parallel int, policy RetryPolicy) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	jobs := make(chan *downloadFile)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				f.Err = downloadAsset(user, repo, token, rel, f, sums, policy)
+			}
+		}()
+	}
+	for _, f := range files {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, f := range files {
+		if f.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d downloads failed", failed, len(files))
+	}
+	return nil
+}
+
+// downloadAsset downloads a single asset to its destination, verifying it
+// against sums unless that is nil. Checksum files themselves are not
+// verified when downloading many files.
+func downloadAsset(user, repo, token string, rel *Release, f *downloadFile, sums checksumFiles, policy RetryPolicy) error {
+	var sum string
+	if sums != nil && !isChecksumFile(f.Asset.Name) {
+		var err error
+		if sum, err = expectedChecksum(sums, rel.Assets, f.Asset.Name); err != nil {
+			return err
+		}
+	}
+	if dir := filepath.Dir(f.Dest); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return downloadToFile(user, repo, rel.TagName, token, f.Asset, f.Dest, sum, policy)
+}
+
+// printDownloadSummary reports the outcome of every download to w.
+func printDownloadSummary(w io.Writer, files []*downloadFile) {
+	for _, f := range files {
+		if f.Err != nil {
+			fmt.Fprintf(w, "%s: failed: %v\n", f.Asset.Name, f.Err)
+		} else {
+			fmt.Fprintf(w, "%s: downloaded to %s (%s)\n", f.Asset.Name, f.Dest, humanize.Bytes(f.Asset.Size))
+		}
+	}
+}
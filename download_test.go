@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadToFile(t *testing.T) {
+	const content = "the current version of the asset"
+	asset := &Asset{Id: 7, Name: "a.txt", Size: uint64(len(content)), Updated: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	var ranges []string
+	supportsRange := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/releases/assets/7" {
+			http.NotFound(w, r)
+			return
+		}
+		rng := r.Header.Get("Range")
+		ranges = append(ranges, rng)
+		if rng != "" && supportsRange {
+			offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if err != nil || offset > len(content) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[offset:]))
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+	defer func(endpoint string, progress bool) { EnvApiEndpoint, showProgress = endpoint, progress }(EnvApiEndpoint, showProgress)
+	EnvApiEndpoint, showProgress = srv.URL, false
+
+	stale := *asset
+	stale.Updated = stale.Updated.Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		part          string // Contents of the leftover .part file.
+		partOf        *Asset // The asset the .part file belongs to.
+		supportsRange bool
+		wantRange     string
+	}{
+		{"fresh", "", nil, true, ""},
+		{"resumed", content[:10], asset, true, "bytes=10-"},
+		{"range ignored", content[:10], asset, false, "bytes=10-"},
+		{"part too large", content + "garbage", asset, true, ""},
+		{"stale part", "the previous", &stale, true, ""},
+		{"part without info", content[:10], nil, true, ""},
+	}
+	for _, tt := range tests {
+		dest := filepath.Join(t.TempDir(), "a.txt")
+		if tt.part != "" {
+			if err := os.WriteFile(dest+".part", []byte(tt.part), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.partOf != nil {
+			if err := os.WriteFile(dest+".part.info", []byte(partInfo(tt.partOf)), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ranges, supportsRange = nil, tt.supportsRange
+
+		if err := downloadToFile("o", "r", "v1.0.0", "token", asset, dest, "", RetryPolicy{Attempts: 1}); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got, _ := os.ReadFile(dest); string(got) != content {
+			t.Errorf("%s: downloaded %q, want %q", tt.name, got, content)
+		}
+		if len(ranges) != 1 || ranges[0] != tt.wantRange {
+			t.Errorf("%s: requested ranges %q, want %q", tt.name, ranges, tt.wantRange)
+		}
+		for _, leftover := range []string{dest + ".part", dest + ".part.info"} {
+			if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+				t.Errorf("%s: %s was left behind", tt.name, filepath.Base(leftover))
+			}
+		}
+	}
+}
+
+func TestSelectAssets(t *testing.T) {
+	assets := []Asset{{Name: "app-linux-amd64.tar.gz"}, {Name: "app-linux-arm64.tar.gz"}, {Name: "app-darwin-arm64.zip"}, {Name: "SHA256SUMS"}}
+
+	tests := []struct {
+		name          string
+		asset         string // The --name option.
+		pattern       string
+		want, wantErr string
+	}{
+		{name: "everything", want: "app-linux-amd64.tar.gz,app-linux-arm64.tar.gz,app-darwin-arm64.zip,SHA256SUMS"},
+		{name: "name", asset: "SHA256SUMS", want: "SHA256SUMS"},
+		{name: "name is not a pattern", asset: "*.zip", wantErr: "no assets matched *.zip"},
+		{name: "glob", pattern: "*.tar.gz", want: "app-linux-amd64.tar.gz,app-linux-arm64.tar.gz"},
+		{name: "glob character class", pattern: "app-*-[a]rm64.*", want: "app-linux-arm64.tar.gz,app-darwin-arm64.zip"},
+		{name: "regex", pattern: `/-arm64\./`, want: "app-linux-arm64.tar.gz,app-darwin-arm64.zip"},
+		{name: "anchored regex", pattern: `/^SHA\d+SUMS$/`, want: "SHA256SUMS"},
+		{name: "single slash is a glob", pattern: "/", wantErr: "no assets matched /"},
+		{name: "invalid glob", pattern: "app-[", wantErr: `invalid pattern "app-["`},
+		{name: "invalid regex", pattern: "/app-(/", wantErr: "invalid regular expression /app-(/"},
+		{name: "no match", pattern: "*.deb", wantErr: "no assets matched *.deb"},
+	}
+	for _, tt := range tests {
+		selected, err := selectAssets(assets, tt.asset, tt.pattern)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, a := range selected {
+			names = append(names, a.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := selectAssets(nil, "", ""); err == nil || !strings.Contains(err.Error(), "release has no assets") {
+		t.Errorf("no assets: got error %v", err)
+	}
+}
+
+func TestDownloadFilesVerify(t *testing.T) {
+	assets := []Asset{
+		{Id: 1, Name: "a.zip", Size: 1, State: "uploaded"},
+		{Id: 2, Name: "b.zip", Size: 1, State: "uploaded"},
+		{Id: 3, Name: "c.zip", Size: 1, State: "uploaded"},
+		{Id: 4, Name: "SHA256SUMS", State: "uploaded"},
+	}
+	manifest := sha256Hex("a") + "  a.zip\n" + sha256Hex("b") + "  b.zip\n" + sha256Hex("not c") + "  c.zip\n"
+	assets[3].Size = uint64(len(manifest))
+	f, rel := newFakeAssets(t, assets...)
+	f.contents = map[int]string{1: "a", 2: "b", 3: "c", 4: manifest}
+	rel.TagName, rel.Assets = "v1", assets
+
+	dir := t.TempDir()
+	var files []*downloadFile
+	var names []string
+	for i := range assets {
+		files = append(files, &downloadFile{Asset: &assets[i], Dest: filepath.Join(dir, assets[i].Name)})
+		names = append(names, assets[i].Name)
+	}
+	sums, err := loadChecksumFiles("o", "r", rel.TagName, "token", rel.Assets, names[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = downloadFiles("o", "r", "token", rel, files, sums, 2, RetryPolicy{Attempts: 1})
+	if err == nil || err.Error() != "1 of 4 downloads failed" {
+		t.Errorf("got error %v, want 1 of 4 downloads failed", err)
+	}
+	for _, file := range files {
+		if wantErr := file.Asset.Name == "c.zip"; (file.Err != nil) != wantErr {
+			t.Errorf("%s: got error %v", file.Asset.Name, file.Err)
+		}
+	}
+
+	manifestReads := 0
+	for _, req := range f.requests {
+		if req == "GET 4" {
+			manifestReads++
+		}
+	}
+	if manifestReads != 2 {
+		t.Errorf("read SHA256SUMS %d times, want once to verify and once to download it", manifestReads)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/github-release/github-release/github"
+)
+
+// The exit codes, documented in the README so that scripts can tell
+// failures apart. 2 is left out, shells use it for misuse.
+const (
+	ExitOK          = 0
+	ExitError       = 1 // Anything not covered below, such as bad arguments.
+	ExitAuth        = 3 // The token is missing, invalid or lacks permissions.
+	ExitNotFound    = 4 // No such repository, release or asset.
+	ExitConflict    = 5 // The release or asset already exists.
+	ExitRateLimited = 6 // Github's rate limit didn't reset in time.
+	ExitNetwork     = 7 // Github couldn't be reached or failed on its side.
+	ExitValidation  = 8 // Github rejected the request as invalid.
+)
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, errNoToken) {
+		return ExitAuth
+	}
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return ExitRateLimited
+	}
+	var releaseErr releaseNotFoundError
+	var assetErr assetNotFoundError
+	if errors.As(err, &releaseErr) || errors.As(err, &assetErr) {
+		return ExitNotFound
+	}
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.StatusCode; {
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			return ExitAuth
+		case code == http.StatusNotFound:
+			return ExitNotFound
+		case code == http.StatusConflict || apiErr.HasCode("already_exists"):
+			return ExitConflict
+		case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+			return ExitValidation
+		case code >= 500:
+			return ExitNetwork
+		}
+		return ExitError
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return ExitNetwork
+	}
+	return ExitError
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/github-release/github-release/github"
+)
+
+func TestExitCode(t *testing.T) {
+	apiErr := func(code int, fieldCodes ...string) error {
+		e := &github.APIError{StatusCode: code, Status: http.StatusText(code)}
+		for _, c := range fieldCodes {
+			e.Errors = append(e.Errors, github.FieldError{Code: c})
+		}
+		return e
+	}
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, ExitOK},
+		{errors.New("empty user"), ExitError},
+		{errNoToken, ExitAuth},
+		{apiErr(http.StatusUnauthorized), ExitAuth},
+		{apiErr(http.StatusForbidden), ExitAuth},
+		{&github.RateLimitError{APIError: apiErr(http.StatusForbidden).(*github.APIError)}, ExitRateLimited},
+		{apiErr(http.StatusNotFound), ExitNotFound},
+		{releaseNotFoundError{"v1.0.0"}, ExitNotFound},
+		{assetNotFoundError{"a.zip"}, ExitNotFound},
+		{apiErr(http.StatusConflict), ExitConflict},
+		{apiErr(http.StatusUnprocessableEntity, "already_exists"), ExitConflict},
+		{apiErr(http.StatusUnprocessableEntity, "invalid"), ExitValidation},
+		{apiErr(http.StatusBadRequest), ExitValidation},
+		{apiErr(http.StatusBadGateway), ExitNetwork},
+		{&url.Error{Op: "Get", URL: "https://api.github.com", Err: errors.New("connection refused")}, ExitNetwork},
+		// Wrapped errors are classified by what they wrap.
+		{fmt.Errorf("could not upload, %w", apiErr(http.StatusNotFound)), ExitNotFound},
+		{retryableError{fmt.Errorf("could not fetch asset, %w", apiErr(http.StatusServiceUnavailable))}, ExitNetwork},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/github-release/github-release/github"
 	"github.com/voxelbrain/goptions"
@@ -11,31 +15,64 @@ import (
 const GH_URL = "https://github.com"
 
 type Options struct {
-	Help      goptions.Help `goptions:"-h, --help, description='Show this help'"`
-	Verbosity []bool        `goptions:"-v, --verbose, description='Be verbose'"`
-	Quiet     bool          `goptions:"-q, --quiet, description='Do not print anything, even errors (except if --verbose is specified)'"`
-	Version   bool          `goptions:"--version, description='Print version'"`
+	Help              goptions.Help `goptions:"-h, --help, description='Show this help'"`
+	Verbosity         []bool        `goptions:"-v, --verbose, description='Be verbose'"`
+	Quiet             bool          `goptions:"-q, --quiet, description='Do not print anything, even errors (except if --verbose is specified)'"`
+	Version           bool          `goptions:"--version, description='Print version'"`
+	DryRun            bool          `goptions:"--dry-run, description='Print the requests that would change the release instead of sending them'"`
+	Cache             bool          `goptions:"--cache, description='Keep API responses in the user cache directory and only fetch them again if they changed, which does not count against the rate limit'"`
+	CACert            string        `goptions:"--cacert, description='PEM file with CA certificates to trust in addition to the system ones, e.g. for Github Enterprise'"`
+	ClientCert        string        `goptions:"--client-cert, description='PEM file with a client certificate to present, for mutual TLS'"`
+	ClientKey         string        `goptions:"--client-key, description='PEM file with the private key of the client certificate (defaults to --client-cert)'"`
+	ConnectTimeout    time.Duration `goptions:"--connect-timeout, description='How long to wait for a connection to be established (0 for no limit)'"`
+	ReadTimeout       time.Duration `goptions:"--read-timeout, description='How long to wait for a response, or for more data while receiving it (0 for no limit)'"`
+	Timeout           time.Duration `goptions:"--timeout, description='Give up on all requests once this much time has passed since the start (0 for no limit)'"`
+	Trace             string        `goptions:"--trace, description='Record all HTTP requests and responses, with credentials redacted, in a file: a HAR archive if it ends in .har, JSON lines otherwise'"`
+	RateLimitWait     time.Duration `goptions:"--rate-limit-wait, description='How long to wait at most for a Github rate limit to reset before giving up (0 to give up right away)'"`
+	Profile           string        `goptions:"--profile, description='Profile of the config file to use ($GITHUB_RELEASE_PROFILE if set)'"`
+	Remote            string        `goptions:"--remote, description='Git remote to take the user and repo from if they are not given otherwise'"`
+	TokenFile         string        `goptions:"--token-file, description='Read the Github token from a file ($GITHUB_TOKEN_FILE if set)'"`
+	TokenCommand      string        `goptions:"--token-command, description='Run a command that prints the Github token'"`
+	GitCredential     bool          `goptions:"--git-credential, description='Ask the git credential helpers for the Github token if none is given otherwise'"`
+	AppID             int64         `goptions:"--app-id, description='Authenticate as an installation of this Github App ($GITHUB_APP_ID if set)'"`
+	AppInstallationID int64         `goptions:"--app-installation-id, description='Installation of the Github App to authenticate as ($GITHUB_APP_INSTALLATION_ID if set)'"`
+	AppKey            string        `goptions:"--app-key, description='PEM file with the private key of the Github App ($GITHUB_APP_PRIVATE_KEY_FILE if set)'"`
 
 	goptions.Verbs
 	Download struct {
-		Token    string `goptions:"-s, --security-token, description='Github token ($GITHUB_TOKEN if set). required if repo is private.'"`
-		User     string `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER not set)'"`
-		AuthUser string `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
-		Repo     string `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
-		Latest   bool   `goptions:"-l, --latest, description='Download latest release (required if tag is not specified)',mutexgroup='input'"`
-		Tag      string `goptions:"-t, --tag, description='Git tag to download from (required if latest is not specified)', mutexgroup='input',obligatory"`
-		Name     string `goptions:"-n, --name, description='Name of the file', obligatory"`
+		Token              string `goptions:"-s, --security-token, description='Github token ($GITHUB_TOKEN if set). required if repo is private.'"`
+		User               string `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER not set)'"`
+		AuthUser           string `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
+		Repo               string `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
+		Latest             bool   `goptions:"-l, --latest, description='Download latest release (required if tag is not specified)',mutexgroup='input'"`
+		Tag                string `goptions:"-t, --tag, description='Git tag to download from (required if latest is not specified)', mutexgroup='input',obligatory"`
+		IncludePrereleases bool   `goptions:"--include-prereleases, description='Let --latest pick pre-releases too'"`
+		Semver             bool   `goptions:"--semver, description='Let --latest pick the highest semantic version tag instead of the most recently published release'"`
+		TagConstraint      string `goptions:"-C, --tag-constraint, description='Pick the release with the highest semantic version tag matching a constraint, e.g. ~1.4, 1.4.x or >=2.0.0 <3', mutexgroup='input'"`
+		Name               string `goptions:"-n, --name, description='Name of the file', mutexgroup='asset', obligatory"`
+		Pattern            string `goptions:"-P, --pattern, description='Download all files matching a glob pattern, or a regular expression if enclosed in slashes (/.../)', mutexgroup='asset'"`
+		All                bool   `goptions:"-A, --all, description='Download all files of the release', mutexgroup='asset'"`
+		OutputDir          string `goptions:"-o, --output-dir, description='Directory to download the files to (defaults to the working directory)'"`
+		Parallel           int    `goptions:"--parallel, description='Number of files to download concurrently'"`
+		Verify             bool   `goptions:"--verify, description='Verify the file against a checksum asset (SHA256SUMS, <name>.sha256, checksums.txt, ...) of the release'"`
+		Attempts           int    `goptions:"--attempts, description='Number of times to try downloading before giving up, interrupted downloads are resumed'"`
 	} `goptions:"download"`
 	Upload struct {
-		Token    string   `goptions:"-s, --security-token, description='Github token (required if $GITHUB_TOKEN not set)'"`
-		User     string   `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER not set)'"`
-		AuthUser string   `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
-		Repo     string   `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
-		Tag      string   `goptions:"-t, --tag, description='Git tag to upload to', obligatory"`
-		Name     string   `goptions:"-n, --name, description='Name of the file', obligatory"`
-		Label    string   `goptions:"-l, --label, description='Label (description) of the file'"`
-		File     *os.File `goptions:"-f, --file, description='File to upload (use - for stdin)', rdonly, obligatory"`
-		Replace  bool     `goptions:"-R, --replace, description='Replace asset with same name if it already exists (WARNING: not atomic, failure to upload will remove the original asset too)'"`
+		Token      string        `goptions:"-s, --security-token, description='Github token (required if $GITHUB_TOKEN not set)'"`
+		User       string        `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER not set)'"`
+		AuthUser   string        `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
+		Repo       string        `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
+		Tag        string        `goptions:"-t, --tag, description='Git tag to upload to', obligatory"`
+		Name       string        `goptions:"-n, --name, description='Name of the file (defaults to the basename of the file, required for stdin)'"`
+		Label      string        `goptions:"-l, --label, description='Label (description) of the file'"`
+		Files      []string      `goptions:"-f, --file, description='File or glob pattern to upload (use - for stdin), can be repeated and given as trailing arguments'"`
+		Parallel   int           `goptions:"--parallel, description='Number of files to upload concurrently'"`
+		StdinLimit string        `goptions:"--stdin-limit, description='Refuse to upload more than this from stdin or another stream, e.g. 2GB (streams are spooled to a temporary file first)'"`
+		Checksums  bool          `goptions:"--checksums, description='Create or update a SHA256SUMS asset listing the checksums of all assets of the release'"`
+		Replace    bool          `goptions:"-R, --replace, description='Replace asset with same name if it already exists (the original is only removed once the new file has been uploaded)'"`
+		Attempts   int           `goptions:"--attempts, description='Number of times to try uploading before giving up'"`
+		RetryDelay time.Duration `goptions:"--retry-delay, description='Delay before the first retry, doubled (with jitter) for every following retry up to 30s, or this delay if it is longer'"`
+		goptions.Remainder
 	} `goptions:"upload"`
 	Release struct {
 		Token                string `goptions:"-s, --security-token, description='Github token (required if $GITHUB_TOKEN not set)'"`
@@ -67,25 +104,47 @@ type Options struct {
 		Repo     string `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
 		Tag      string `goptions:"-t, --tag, obligatory, description='Git tag of release to delete'"`
 	} `goptions:"delete"`
-	Info struct {
-		Token    string `goptions:"-s, --security-token, description='Github token ($GITHUB_TOKEN if set). required if repo is private.'"`
+	Checksums struct {
+		Token    string `goptions:"-s, --security-token, description='Github token (required if $GITHUB_TOKEN not set)'"`
 		User     string `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER not set)'"`
 		AuthUser string `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
 		Repo     string `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
-		Tag      string `goptions:"-t, --tag, description='Git tag to query (optional)'"`
-		JSON     bool   `goptions:"-j, --json, description='Emit info as JSON instead of text'"`
+		Tag      string `goptions:"-t, --tag, obligatory, description='Git tag of the release to compute the SHA256SUMS asset of'"`
+	} `goptions:"checksums"`
+	Apply struct {
+		Token    string `goptions:"-s, --security-token, description='Github token (required if $GITHUB_TOKEN not set)'"`
+		User     string `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER and the manifest do not set it)'"`
+		AuthUser string `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
+		Repo     string `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO and the manifest do not set it)'"`
+		File     string `goptions:"-f, --file, obligatory, description='YAML or JSON manifest describing the release (use - for stdin)'"`
+		Prune    bool   `goptions:"--prune, description='Delete assets not listed in the manifest'"`
+	} `goptions:"apply"`
+	Info struct {
+		Token              string `goptions:"-s, --security-token, description='Github token ($GITHUB_TOKEN if set). required if repo is private.'"`
+		User               string `goptions:"-u, --user, description='Github repo user or organisation (required if $GITHUB_USER not set)'"`
+		AuthUser           string `goptions:"-a, --auth-user, description='Username for authenticating to the API (falls back to $GITHUB_AUTH_USER or $GITHUB_USER)'"`
+		Repo               string `goptions:"-r, --repo, description='Github repo (required if $GITHUB_REPO not set)'"`
+		Tag                string `goptions:"-t, --tag, description='Git tag to query (optional)', mutexgroup='input'"`
+		Latest             bool   `goptions:"-l, --latest, description='Query the latest release', mutexgroup='input'"`
+		IncludePrereleases bool   `goptions:"--include-prereleases, description='Let --latest pick pre-releases too'"`
+		Semver             bool   `goptions:"--semver, description='Let --latest pick the highest semantic version tag instead of the most recently published release'"`
+		TagConstraint      string `goptions:"-C, --tag-constraint, description='Pick the release with the highest semantic version tag matching a constraint, e.g. ~1.4, 1.4.x or >=2.0.0 <3', mutexgroup='input'"`
+		JSON               bool   `goptions:"-j, --json, description='Emit info as JSON instead of text'"`
+		Limit              int    `goptions:"--limit, description='List only this many of the most recent tags and releases (0 for all)'"`
 	} `goptions:"info"`
 }
 
 type Command func(Options) error
 
 var commands = map[goptions.Verbs]Command{
-	"download": downloadcmd,
-	"upload":   uploadcmd,
-	"release":  releasecmd,
-	"edit":     editcmd,
-	"delete":   deletecmd,
-	"info":     infocmd,
+	"download":  downloadcmd,
+	"upload":    uploadcmd,
+	"release":   releasecmd,
+	"edit":      editcmd,
+	"delete":    deletecmd,
+	"info":      infocmd,
+	"checksums": checksumscmd,
+	"apply":     applycmd,
 }
 
 var (
@@ -95,19 +154,32 @@ var (
 var (
 	// The user whose token is being used to authenticate to the API. If unset,
 	// EnvUser is used.
-	EnvAuthUser    string
-	EnvToken       string
-	EnvUser        string
-	EnvRepo        string
-	EnvApiEndpoint string
+	EnvAuthUser          string
+	EnvToken             string
+	EnvTokenFile         string
+	EnvAppID             string
+	EnvAppInstallationID string
+	EnvAppKeyFile        string
+	EnvUser              string
+	EnvRepo              string
+	EnvApiEndpoint       string
+	// Where to upload assets to instead of the upload URL of the release,
+	// only set by config files.
+	EnvUploadEndpoint string
+	EnvProfile        string
 )
 
 func init() {
 	EnvToken = os.Getenv("GITHUB_TOKEN")
+	EnvTokenFile = os.Getenv("GITHUB_TOKEN_FILE")
+	EnvAppID = os.Getenv("GITHUB_APP_ID")
+	EnvAppInstallationID = os.Getenv("GITHUB_APP_INSTALLATION_ID")
+	EnvAppKeyFile = os.Getenv("GITHUB_APP_PRIVATE_KEY_FILE")
 	EnvUser = os.Getenv("GITHUB_USER")
 	EnvAuthUser = os.Getenv("GITHUB_AUTH_USER")
 	EnvRepo = os.Getenv("GITHUB_REPO")
 	EnvApiEndpoint = os.Getenv("GITHUB_API")
+	EnvProfile = os.Getenv("GITHUB_RELEASE_PROFILE")
 
 	if EnvAuthUser == "" {
 		EnvAuthUser = EnvUser
@@ -116,6 +188,15 @@ func init() {
 
 func main() {
 	options := Options{}
+	options.Remote = "origin"
+	options.RateLimitWait = github.RateLimitWait
+	options.ConnectTimeout = 30 * time.Second
+	options.ReadTimeout = 5 * time.Minute
+	options.Upload.Attempts = DefaultRetryPolicy.Attempts
+	options.Upload.RetryDelay = DefaultRetryPolicy.BaseDelay
+	options.Upload.Parallel = 1
+	options.Download.Attempts = DefaultRetryPolicy.Attempts
+	options.Download.Parallel = 4
 
 	goptions.ParseAndFail(&options)
 
@@ -131,14 +212,122 @@ func main() {
 
 	VERBOSITY = len(options.Verbosity)
 	github.VERBOSITY = VERBOSITY
+	github.DryRun = options.DryRun
+	github.RateLimitWait = options.RateLimitWait
+	if options.Cache {
+		enableCache()
+	}
+	showProgress = !options.Quiet
+	useGitCredential = options.GitCredential
 
 	if cmd, found := commands[options.Verbs]; found {
-		err := cmd(options)
+		err := configure(options)
+		if err == nil {
+			err = cmd(options)
+		}
+		if terr := closeTrace(); err == nil {
+			err = terr
+		}
 		if err != nil {
 			if !options.Quiet {
 				fmt.Fprintln(os.Stderr, "error:", err)
 			}
-			os.Exit(1)
+			var apiErr *github.APIError
+			if errors.As(err, &apiErr) && apiErr.DocumentationURL != "" {
+				vprintf("see %s\n", apiErr.DocumentationURL)
+			}
+			os.Exit(exitCode(err))
 		}
 	}
 }
+
+// configureHTTP sets up TLS and timeouts for all requests.
+func configureHTTP(options Options) error {
+	o := github.HTTPOptions{
+		CACert:         options.CACert,
+		ClientCert:     options.ClientCert,
+		ClientKey:      options.ClientKey,
+		ConnectTimeout: options.ConnectTimeout,
+		ReadTimeout:    options.ReadTimeout,
+	}
+	if options.Timeout > 0 {
+		o.Deadline = time.Now().Add(options.Timeout)
+	}
+	var err error
+	if o.Tracer, err = openTrace(options.Trace); err != nil {
+		return err
+	}
+	return github.SetHTTPOptions(o)
+}
+
+// The trace of all HTTP traffic, if one was asked for.
+var (
+	tracer    *github.Tracer
+	traceFile *os.File
+)
+
+// openTrace starts a trace in the file at path: a HAR archive if its name
+// ends in .har, JSON lines otherwise. Without a path, $DEBUG_HTTP_TRAFFIC
+// set to true traces to stderr.
+func openTrace(path string) (*github.Tracer, error) {
+	if path == "" {
+		if os.Getenv("DEBUG_HTTP_TRAFFIC") == "true" {
+			tracer = github.NewTracer(os.Stderr, false)
+		}
+		return tracer, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open trace: %v", err)
+	}
+	traceFile = f
+	tracer = github.NewTracer(f, strings.EqualFold(filepath.Ext(path), ".har"))
+	return tracer, nil
+}
+
+// closeTrace completes the trace, if there is one.
+func closeTrace() error {
+	if tracer == nil {
+		return nil
+	}
+	err := tracer.Flush()
+	if traceFile != nil {
+		if cerr := traceFile.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// enableCache caches API responses in the user cache directory, if there is
+// one.
+func enableCache() {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		vprintln("not caching responses:", err)
+		return
+	}
+	github.DefaultCache = &github.Cache{Dir: filepath.Join(dir, "github-release", "http")}
+}
+
+// configure sets the defaults for all commands (EnvUser and friends) from,
+// in order of decreasing priority, the global options, the environment, the
+// config files and the git remote.
+func configure(options Options) error {
+	if err := configureHTTP(options); err != nil {
+		return err
+	}
+	profile, named, err := applyProfile(nvls(options.Profile, EnvProfile))
+	if err != nil {
+		return err
+	}
+	// The token is resolved once the profile has set the endpoint, so that
+	// a Github App doesn't request an installation token from the wrong host.
+	if EnvToken, err = resolveToken(options, profile, named); err != nil {
+		return err
+	}
+	github.AddSecret(EnvToken)
+	inferFromRemote(options.Remote)
+	applyAuthUser(profile, named)
+	return nil
+}
@@ -0,0 +1,171 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long before it expires an installation token is replaced.
+const appTokenMargin = 5 * time.Minute
+
+// App authenticates as an installation of a Github App: it signs a JWT with
+// the private key of the app and exchanges it for an installation token,
+// which is cached until it is about to expire.
+type App struct {
+	ID             int64
+	InstallationID int64
+	Key            *rsa.PrivateKey
+	BaseURL        string       // API endpoint, DefaultBaseURL if empty.
+	Client         *http.Client // The client configured by SetHTTPOptions if nil.
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	issued  map[string]bool // All tokens ever handed out.
+}
+
+// Requests made with a token of DefaultApp use a fresh one instead once it
+// is about to expire, so that callers can keep passing around the token
+// they got first.
+var DefaultApp *App
+
+// ParsePrivateKey parses the PEM encoded private key Github generates for
+// apps (PKCS #1), or a PKCS #8 one.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is a %T, not an RSA key", key)
+	}
+	return rsaKey, nil
+}
+
+// JWT returns a JSON Web Token identifying the app, valid for a few
+// minutes from now. The issue time is backdated a little to allow for
+// clock drift, as Github recommends.
+func (a *App) JWT(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": fmt.Sprint(a.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// Token returns an installation token, from the cache if it isn't about to
+// expire.
+func (a *App) Token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Until(a.expires) > appTokenMargin {
+		return a.token, nil
+	}
+
+	jwt, err := a.JWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+	AddSecret(jwt)
+	url := strings.TrimSuffix(a.BaseURL, "/")
+	if url == "" {
+		url = DefaultBaseURL
+	}
+	url += fmt.Sprintf("/app/installations/%d/access_tokens", a.InstallationID)
+	vprintln("requesting installation token:", url)
+
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", uaPart)
+	client := a.Client
+	if client == nil {
+		client = defaultHttpClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not get an installation token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("could not get an installation token: %w", parseError(resp))
+	}
+
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("could not decode installation token: %v", err)
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("no installation token in response")
+	}
+	AddSecret(body.Token)
+	a.token, a.expires = body.Token, body.ExpiresAt
+	if a.issued == nil {
+		a.issued = make(map[string]bool)
+	}
+	a.issued[a.token] = true
+	vprintln("installation token expires at", a.expires)
+	return a.token, nil
+}
+
+// owns reports whether token was issued to the app.
+func (a *App) owns(token string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.issued[token]
+}
+
+// authorize sets the Authorization header of req for token: a token of
+// DefaultApp is replaced by a current one, as it may have expired during a
+// long running operation; any other token is sent as the password of basic
+// auth.
+func authorize(req *http.Request, username, token string) error {
+	if DefaultApp != nil && DefaultApp.owns(token) {
+		fresh, err := DefaultApp.Token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+fresh)
+		return nil
+	}
+	req.SetBasicAuth(username, token)
+	return nil
+}
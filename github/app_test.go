@@ -0,0 +1,122 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchanges := 0
+	lifetime := time.Hour
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/app/installations/42/access_tokens" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			http.Error(w, `{"message":"no JWT"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := verifyJWT(jwt, &key.PublicKey); err != nil {
+			t.Errorf("invalid JWT: %v", err)
+			http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+			return
+		}
+		exchanges++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("ghs_%d", exchanges),
+			"expires_at": time.Now().Add(lifetime).UTC().Format(time.RFC3339),
+		})
+	}))
+	defer srv.Close()
+
+	der := x509.MarshalPKCS1PrivateKey(key)
+	parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{ID: 7, InstallationID: 42, Key: parsed, BaseURL: srv.URL}
+
+	first, err := app.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := app.Token(); again != first || exchanges != 1 {
+		t.Errorf("token should be cached, got %s after %d exchanges", again, exchanges)
+	}
+
+	// Tokens about to expire are replaced, and requests made with the
+	// first token use the current one.
+	DefaultApp = app
+	defer func() { DefaultApp = nil }()
+	app.expires = time.Now().Add(time.Minute)
+	req, err := NewClient("", first, nil).NewRequest("GET", srv.URL+"/repos/o/r/releases", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer ghs_2" || exchanges != 2 {
+		t.Errorf("Authorization = %q after %d exchanges, want the second token", got, exchanges)
+	}
+
+	// Other tokens are left alone.
+	req, _ = NewClient("", "ghp_personal", nil).NewRequest("GET", srv.URL+"/repos/o/r/releases", nil)
+	if _, password, ok := req.BasicAuth(); !ok || password != "ghp_personal" {
+		t.Errorf("personal token not sent with basic auth: %q", req.Header.Get("Authorization"))
+	}
+
+	wrong := &App{ID: 7, InstallationID: 1, Key: key, BaseURL: srv.URL}
+	if _, err := wrong.Token(); err == nil || !strings.Contains(err.Error(), "Not Found") {
+		t.Errorf("unknown installation: %v", err)
+	}
+}
+
+func verifyJWT(jwt string, pub *rsa.PublicKey) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("%d parts", len(parts))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		return err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if claims.Iss != "7" || claims.Iat > now || claims.Exp <= now || claims.Exp-claims.Iat > 600 {
+		return fmt.Errorf("bad claims %+v", claims)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entries that haven't been used for this long are removed, e.g. those of
+// tokens that are long gone.
+const cacheMaxAge = 30 * 24 * time.Hour
+
+// Cache keeps the responses to GET requests of Client.Get that carry an
+// ETag on disk, one file per URL (and thus per page) and identity. They are
+// revalidated with If-None-Match, and Github doesn't count the 304 Not
+// Modified responses against the rate limit.
+type Cache struct {
+	Dir string
+
+	prune sync.Once
+}
+
+// Responses of Client.Get are cached in DefaultCache, unless it is nil.
+var DefaultCache *Cache
+
+// path returns the file holding the response to req. The key covers the
+// identity req is sent as, so that responses to different tokens (which may
+// see different things) are kept apart without storing the tokens
+// themselves.
+func (c *Cache) path(req *http.Request) string {
+	h := sha256.New()
+	io.WriteString(h, identity(req)+"\x00"+req.Header.Get("Accept")+"\x00"+req.URL.String())
+	return filepath.Join(c.Dir, hex.EncodeToString(h.Sum(nil)))
+}
+
+// identity returns who req is sent as: the installation of DefaultApp for
+// its tokens, which are new every run, the credentials themselves
+// otherwise.
+func identity(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok && DefaultApp != nil && DefaultApp.owns(token) {
+		return fmt.Sprintf("app %d installation %d", DefaultApp.ID, DefaultApp.InstallationID)
+	}
+	return auth
+}
+
+// removeStale removes the entries that haven't been used for cacheMaxAge
+// as of now.
+func (c *Cache) removeStale(now time.Time) {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || now.Sub(info.ModTime()) < cacheMaxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.Dir, entry.Name())); err != nil {
+			vprintln("could not remove stale cache entry:", err)
+		}
+	}
+}
+
+// load returns the cached response to req, or nil.
+func (c *Cache) load(req *http.Request) *http.Response {
+	b, err := os.ReadFile(c.path(req))
+	if err != nil {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		vprintln("ignoring corrupt cache entry:", err)
+		return nil
+	}
+	return resp
+}
+
+// store writes resp to the cache and returns it with its body still
+// readable.
+func (c *Cache) store(req *http.Request, resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var buf bytes.Buffer
+	cached := *resp
+	cached.Body = io.NopCloser(bytes.NewReader(body))
+	cached.ContentLength = int64(len(body))
+	cached.TransferEncoding = nil
+	err = cached.Write(&buf)
+	if err == nil {
+		err = c.write(c.path(req), buf.Bytes())
+	}
+	if err != nil {
+		vprintln("could not cache response:", err)
+	}
+	return resp, nil
+}
+
+// write replaces the file at path with data, atomically so that concurrent
+// runs never see half an entry.
+func (c *Cache) write(path string, data []byte) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// do sends req with send, conditionally if a response to it is cached. If
+// Github says it is still current, the cached response is returned.
+func (c *Cache) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	c.prune.Do(func() { c.removeStale(time.Now()) })
+	cached := c.load(req)
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+	}
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		vprintln("not modified, using cached response:", req.URL)
+		// Mark the entry as used, see removeStale.
+		now := time.Now()
+		os.Chtimes(c.path(req), now, now)
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		return resp, nil
+	}
+	return c.store(req, resp)
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	defer func() { DefaultCache = nil }()
+	DefaultCache = &Cache{Dir: t.TempDir()}
+
+	var sent, notModified int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		page := r.URL.Query().Get("page")
+		etag := `"page` + page + `"`
+		w.Header().Set("ETag", etag)
+		if page == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, srv.URL))
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, `[{"id": 1%s}]`, page)
+	}))
+	defer srv.Close()
+
+	get := func(token string) []int {
+		c := NewClient("", token, nil)
+		c.SetBaseURL(srv.URL)
+		items, err := All(Paginate[struct{ Id int }](c, "/items", PageOptions{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, it := range items {
+			ids = append(ids, it.Id)
+		}
+		return ids
+	}
+
+	want := []int{1, 12}
+	if got := get("s3cr3t"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first run: got %v, want %v", got, want)
+	}
+	if got := get("s3cr3t"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("cached run: got %v, want %v", got, want)
+	}
+	if sent != 4 || notModified != 2 {
+		t.Errorf("sent %d requests, %d not modified; want every page revalidated", sent, notModified)
+	}
+
+	// Another token doesn't get to see the responses to the first one.
+	get("other")
+	if notModified != 2 {
+		t.Errorf("responses shared between tokens")
+	}
+	entries, _ := os.ReadDir(DefaultCache.Dir)
+	if len(entries) != 4 {
+		t.Errorf("%d cache entries, want 4", len(entries))
+	}
+}
+
+func TestCacheIdentity(t *testing.T) {
+	defer func() { DefaultApp = nil }()
+	DefaultApp = &App{ID: 1, InstallationID: 2, issued: map[string]bool{"ghs_first": true, "ghs_second": true}}
+	c := &Cache{Dir: t.TempDir()}
+
+	path := func(auth string) string {
+		req, err := http.NewRequest("GET", "https://api.github.com/repos/o/r/releases", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", auth)
+		return c.path(req)
+	}
+	if path("Bearer ghs_first") != path("Bearer ghs_second") {
+		t.Error("tokens of the same installation have different cache entries")
+	}
+	if path("Bearer ghs_first") == path("Bearer ghs_other") {
+		t.Error("a token of someone else shares the cache entry of the installation")
+	}
+	if path("Basic dTpzM2NyM3Q=") == path("Basic dTpvdGhlcg==") {
+		t.Error("different tokens share a cache entry")
+	}
+}
+
+func TestCacheRemoveStale(t *testing.T) {
+	c := &Cache{Dir: t.TempDir()}
+	now := time.Now()
+	ages := map[string]time.Duration{"fresh": time.Hour, "used": cacheMaxAge - time.Hour, "stale": cacheMaxAge + time.Hour}
+	for name, age := range ages {
+		path := filepath.Join(c.Dir, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.removeStale(now)
+	entries, _ := os.ReadDir(c.Dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"fresh", "used"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("entries left %v, want %v", names, want)
+	}
+}
@@ -7,7 +7,7 @@ import (
 
 func vprintln(a ...interface{}) (int, error) {
 	if VERBOSITY > 0 {
-		return fmt.Fprintln(os.Stderr, a...)
+		return fmt.Fprint(os.Stderr, Redact(fmt.Sprintln(a...)))
 	}
 
 	return 0, nil
@@ -15,7 +15,7 @@ func vprintln(a ...interface{}) (int, error) {
 
 func vprintf(format string, a ...interface{}) (int, error) {
 	if VERBOSITY > 0 {
-		return fmt.Fprintf(os.Stderr, format, a...)
+		return fmt.Fprint(os.Stderr, Redact(fmt.Sprintf(format, a...)))
 	}
 
 	return 0, nil
@@ -0,0 +1,113 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Set to true to print requests that would change anything on Github
+// instead of sending them. Reads are still sent, so that releases, assets
+// and so on can be resolved as usual.
+var DryRun = false
+
+// DryRunOutput is where the requests skipped by DryRun are printed.
+var DryRunOutput io.Writer = os.Stdout
+
+// The largest request body that is printed in full by a dry run. Anything
+// bigger (i.e. asset uploads) is only described.
+const dryRunMaxBody = 1 << 20
+
+// dryRun prints req and makes up a successful response for it, if DryRun is
+// set and req is a write. Otherwise it returns nil and req should be sent.
+func dryRun(req *http.Request) (*http.Response, error) {
+	if !DryRun || req.Method == "GET" || req.Method == "HEAD" {
+		return nil, nil
+	}
+
+	var payload []byte
+	if req.Body != nil {
+		defer req.Body.Close()
+		if req.ContentLength <= dryRunMaxBody {
+			var err error
+			if payload, err = io.ReadAll(io.LimitReader(req.Body, dryRunMaxBody)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", req.Method, req.URL)
+	if req.Header.Get("Authorization") != "" {
+		fmt.Fprintln(&buf, "Authorization:", redacted)
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		fmt.Fprintln(&buf, "Content-Type:", ct)
+	}
+	switch {
+	case json.Valid(payload):
+		json.Indent(&buf, payload, "", "  ")
+		buf.WriteByte('\n')
+	case req.ContentLength > 0:
+		fmt.Fprintf(&buf, "<%d bytes>\n", req.ContentLength)
+	case len(payload) > 0:
+		fmt.Fprintln(&buf, "<stream of unknown length>")
+	}
+	buf.WriteByte('\n')
+	if _, err := io.WriteString(DryRunOutput, Redact(buf.String())); err != nil {
+		return nil, err
+	}
+
+	status := http.StatusOK
+	switch req.Method {
+	case "POST":
+		status = http.StatusCreated
+	case "DELETE":
+		status = http.StatusNoContent
+	}
+	body := dryRunResponse(req, payload)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// dryRunResponse makes up the JSON body Github would respond to req with,
+// as far as the caller cares: the object that was sent, or the asset that
+// was uploaded. Made up objects have id 0.
+func dryRunResponse(req *http.Request, payload []byte) []byte {
+	obj := make(map[string]interface{})
+	json.Unmarshal(payload, &obj)
+
+	if name := req.URL.Query().Get("name"); name != "" && req.Method == "POST" {
+		// An asset upload.
+		obj = map[string]interface{}{
+			"name":  name,
+			"label": req.URL.Query().Get("label"),
+			"state": "uploaded",
+			"size":  req.ContentLength,
+		}
+	}
+	if req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/releases") {
+		// A new release, which assets may be uploaded to next.
+		u := *req.URL
+		u.Path += "/0/assets"
+		u.RawQuery = ""
+		obj["upload_url"] = u.String() + "{?name,label}"
+	}
+	obj["id"] = 0
+
+	b, _ := json.Marshal(obj)
+	return b
+}
@@ -0,0 +1,76 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	var out bytes.Buffer
+	DryRun, DryRunOutput = true, &out
+	defer func() { DryRun = false }()
+
+	req, err := NewClient("", "s3cr3t", nil).NewRequest("GET", "https://api.github.com/repos/o/r/releases", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := dryRun(req); resp != nil || err != nil {
+		t.Fatalf("reads should be sent, got %v, %v", resp, err)
+	}
+
+	req, err = NewClient("", "s3cr3t", nil).NewRequest("POST", "https://api.github.com/repos/o/r/releases",
+		strings.NewReader(`{"tag_name":"v1.0.0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := dryRun(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("status = %d, want 201", resp.StatusCode)
+	}
+	var rel struct {
+		TagName   string `json:"tag_name"`
+		UploadUrl string `json:"upload_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		t.Fatal(err)
+	}
+	if rel.TagName != "v1.0.0" || rel.UploadUrl == "" {
+		t.Errorf("made up release = %+v", rel)
+	}
+
+	printed := out.String()
+	if strings.Contains(printed, "s3cr3t") || !strings.Contains(printed, "[REDACTED]") {
+		t.Errorf("token not redacted:\n%s", printed)
+	}
+	for _, want := range []string{"POST https://api.github.com/repos/o/r/releases\n", `"tag_name": "v1.0.0"`} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("output lacks %q:\n%s", want, printed)
+		}
+	}
+
+	out.Reset()
+	req, _ = NewClient("", "s3cr3t", nil).NewRequest("POST", "https://uploads.github.com/repos/o/r/releases/1/assets?name=app.tar.gz",
+		bytes.NewReader(make([]byte, 100)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = dryRun(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asset struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+	json.NewDecoder(resp.Body).Decode(&asset)
+	if asset.Name != "app.tar.gz" || asset.Size != 100 {
+		t.Errorf("made up asset = %+v", asset)
+	}
+	if !strings.Contains(out.String(), "<100 bytes>") {
+		t.Errorf("upload body should only be described:\n%s", out.String())
+	}
+}
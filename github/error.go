@@ -0,0 +1,115 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned for responses with an unexpected status.
+type APIError struct {
+	StatusCode       int
+	Status           string       // e.g. "404 Not Found"
+	Message          string       // As sent by Github, if it did.
+	Errors           []FieldError // What was wrong with the request, if Github said.
+	DocumentationURL string
+	RequestID        string // The X-GitHub-Request-Id, which Github support asks for.
+}
+
+// FieldError describes one problem with a request Github couldn't process,
+// typically a 422 Unprocessable Entity.
+type FieldError struct {
+	Resource string `json:"resource"` // e.g. "Release"
+	Field    string `json:"field"`    // e.g. "tag_name"
+	Code     string `json:"code"`     // e.g. "already_exists", "invalid" or "custom"
+	Message  string `json:"message"`  // Only set for some codes.
+}
+
+// UnmarshalJSON also accepts a plain string, which Github sends for some
+// errors instead of an object.
+func (e *FieldError) UnmarshalJSON(b []byte) error {
+	var msg string
+	if json.Unmarshal(b, &msg) == nil {
+		*e = FieldError{Message: msg}
+		return nil
+	}
+	type fieldError FieldError // Without this method.
+	return json.Unmarshal(b, (*fieldError)(e))
+}
+
+func (e FieldError) String() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Field == "" {
+		return e.Code
+	}
+	return e.Field + " " + e.Code
+}
+
+func (e *APIError) Error() string {
+	s := "github returned " + e.Status
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	if len(e.Errors) > 0 {
+		details := make([]string, len(e.Errors))
+		for i, fe := range e.Errors {
+			details[i] = fe.String()
+		}
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	if e.RequestID != "" {
+		s += fmt.Sprintf(" [request id %s]", e.RequestID)
+	}
+	return s
+}
+
+// HasCode reports whether Github gave code for any of the field errors,
+// e.g. "already_exists".
+func (e *APIError) HasCode(code string) bool {
+	for _, fe := range e.Errors {
+		if fe.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIError describes resp, of which body is the (possibly partial)
+// body, as an *APIError.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestID:  resp.Header.Get("X-GitHub-Request-Id"),
+	}
+	var msg struct {
+		Message          string       `json:"message"`
+		Errors           []FieldError `json:"errors"`
+		DocumentationURL string       `json:"documentation_url"`
+	}
+	if json.Unmarshal(body, &msg) == nil {
+		apiErr.Message = msg.Message
+		apiErr.Errors = msg.Errors
+		apiErr.DocumentationURL = msg.DocumentationURL
+	}
+	return apiErr
+}
+
+// The most of an error response that is read.
+const maxErrorBody = 64 << 10
+
+// parseError turns an error response into an *APIError, or a
+// *RateLimitError if it is about a rate limit, consuming its body.
+func parseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	apiErr := newAPIError(resp, b)
+	if wait, ok := rateLimitDelay(resp, b); ok {
+		return &RateLimitError{apiErr, now().Add(wait)}
+	}
+	return apiErr
+}
@@ -0,0 +1,51 @@
+package github
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusUnprocessableEntity,
+		Status:     "422 Unprocessable Entity",
+		Header:     http.Header{"X-Github-Request-Id": {"C0DE:1234"}},
+		Body: io.NopCloser(strings.NewReader(`{
+			"message": "Validation Failed",
+			"errors": [
+				{"resource": "Release", "code": "already_exists", "field": "tag_name"},
+				"name is too long"
+			],
+			"documentation_url": "https://docs.github.com/rest/releases/releases#create-a-release"
+		}`)),
+	}
+	err := parseError(resp)
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("want an *APIError, got %#v", err)
+	}
+	want := &APIError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Status:     "422 Unprocessable Entity",
+		Message:    "Validation Failed",
+		Errors: []FieldError{
+			{Resource: "Release", Field: "tag_name", Code: "already_exists"},
+			{Message: "name is too long"},
+		},
+		DocumentationURL: "https://docs.github.com/rest/releases/releases#create-a-release",
+		RequestID:        "C0DE:1234",
+	}
+	if !reflect.DeepEqual(apiErr, want) {
+		t.Errorf("got %#v, want %#v", apiErr, want)
+	}
+	if !apiErr.HasCode("already_exists") || apiErr.HasCode("invalid") {
+		t.Errorf("HasCode does not match %v", apiErr.Errors)
+	}
+	msg := "github returned 422 Unprocessable Entity: Validation Failed (tag_name already_exists, name is too long) [request id C0DE:1234]"
+	if err.Error() != msg {
+		t.Errorf("got message %q, want %q", err.Error(), msg)
+	}
+}
@@ -1,13 +1,20 @@
 package github
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 )
 
+// A SizedReader is a request body that knows its length up front. The
+// upload server doesn't accept chunked requests, so bodies that aren't
+// files must implement this to be uploaded.
+type SizedReader interface {
+	io.Reader
+	Size() int64
+}
+
 func GetFileSize(f *os.File) (int64, error) {
 	/* first try stat */
 	off, err := fsizeStat(f)
@@ -45,32 +52,91 @@ func fsizeSeek(f *os.File) (int64, error) {
 	return off, nil
 }
 
-// materializeFile takes a physical file or stream (named pipe, user input,
-// ...) and returns an io.Reader and the number of bytes that can be read
-// from it.
-func materializeFile(f *os.File) (io.Reader, int64, error) {
+// SpoolLimit caps the number of bytes MaterializeFile and SpoolFile will
+// read from a stream. Zero means no limit.
+var SpoolLimit int64
+
+// IsStream reports whether f is a stream (pipe, terminal, socket, ...)
+// rather than a regular file whose size is known up front.
+func IsStream(f *os.File) (bool, error) {
 	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return fi.Mode()&(os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket) != 0, nil
+}
+
+// SpoolFile copies the stream f into a temporary file, reading at most
+// SpoolLimit bytes, and returns it rewound along with its size. The caller
+// is responsible for closing and removing the file.
+func SpoolFile(f *os.File) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "github-release-spool-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not create spool file: %v", err)
+	}
+	fail := func(err error) (*os.File, int64, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+
+	var r io.Reader = f
+	if SpoolLimit > 0 {
+		// Read one byte past the limit to tell a stream that is exactly
+		// SpoolLimit bytes long from one that is longer.
+		r = io.LimitReader(f, SpoolLimit+1)
+	}
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		return fail(errors.New("req: could not spool input stream: " + err.Error()))
+	}
+	if SpoolLimit > 0 && n > SpoolLimit {
+		return fail(fmt.Errorf("input stream is larger than the limit of %d bytes", SpoolLimit))
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return tmp, n, nil
+}
+
+// spooledFile is a spooled copy of a stream that cleans up after itself
+// when closed.
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// MaterializeFile takes a physical file or stream (named pipe, user input,
+// ...) and returns an io.Reader and the number of bytes that can be read
+// from it. If the reader is also an io.Closer, it must be closed.
+func MaterializeFile(f *os.File) (io.Reader, int64, error) {
+	stream, err := IsStream(f)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// If the file is actually a char device (like user typed input)
-	// or a named pipe (like a streamed in file), buffer it up.
+	// or a named pipe (like a streamed in file), spool it to disk.
 	//
 	// When uploading a file, you need to either explicitly set the
 	// Content-Length header or send a chunked request. Since the
 	// github upload server doesn't accept chunked encoding, we have
 	// to set the size of the file manually. Since a stream doesn't have a
-	// predefined length, it's read entirely into a byte buffer.
-	if fi.Mode()&(os.ModeCharDevice|os.ModeNamedPipe) == 1 {
-		vprintln("input was a stream, buffering up")
+	// predefined length, it's read entirely into a temporary file, which
+	// unlike a memory buffer also works for very large inputs.
+	if stream {
+		vprintln("input was a stream, spooling to disk")
 
-		var buf bytes.Buffer
-		n, err := buf.ReadFrom(f)
+		tmp, n, err := SpoolFile(f)
 		if err != nil {
-			return nil, 0, errors.New("req: could not buffer up input stream: " + err.Error())
+			return nil, 0, err
 		}
-		return &buf, n, err
+		return spooledFile{tmp}, n, nil
 	}
 
 	// We know the os.File is most likely an actual file now.
@@ -1,6 +1,7 @@
 package github
 
 import (
+	"io"
 	"os"
 	"testing"
 )
@@ -38,3 +39,115 @@ func TestGetFileSize(t *testing.T) {
 		}
 	}
 }
+
+func TestMaterializeFileRegular(t *testing.T) {
+	f, err := os.Open("file.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, n, err := MaterializeFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != io.Reader(f) {
+		t.Errorf("regular file should be used as is, got %T", r)
+	}
+	size, _ := fsizeStat(f)
+	if n != size {
+		t.Errorf("size: got %d, want %d", n, size)
+	}
+}
+
+func TestMaterializeFilePipe(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	const data = "streamed in through a pipe"
+	go func() {
+		io.WriteString(pw, data)
+		pw.Close()
+	}()
+
+	r, n, err := MaterializeFile(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spooled, ok := r.(spooledFile)
+	if !ok {
+		t.Fatalf("pipe should be spooled to disk, got %T", r)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("size: got %d, want %d", n, len(data))
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != data {
+		t.Errorf("contents: got %q, want %q", b, data)
+	}
+	if err := spooled.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(spooled.Name()); !os.IsNotExist(err) {
+		t.Errorf("spool file %s was not removed on close", spooled.Name())
+	}
+}
+
+func TestMaterializeFileCharDevice(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if stream, err := IsStream(f); err != nil || !stream {
+		t.Skipf("%s is not a character device here", os.DevNull)
+	}
+
+	r, n, err := MaterializeFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.(io.Closer).Close()
+	if _, ok := r.(spooledFile); !ok {
+		t.Errorf("char device should be spooled to disk, got %T", r)
+	}
+	if n != 0 {
+		t.Errorf("size: got %d, want 0", n)
+	}
+}
+
+func TestSpoolFileLimit(t *testing.T) {
+	defer func(limit int64) { SpoolLimit = limit }(SpoolLimit)
+	SpoolLimit = 4
+
+	for _, tt := range []struct {
+		data string
+		ok   bool
+	}{
+		{"1234", true},
+		{"12345", false},
+	} {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			io.WriteString(pw, tt.data)
+			pw.Close()
+		}()
+		f, _, err := SpoolFile(pr)
+		pr.Close()
+		if tt.ok != (err == nil) {
+			t.Errorf("%q: got error %v, want ok=%v", tt.data, err, tt.ok)
+		}
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/url"
+	"strconv"
+
+	"github.com/tomnomnom/linkheader"
+)
+
+// The most items Github returns per page.
+const maxPerPage = 100
+
+// PageOptions control the iteration over a paginated list.
+type PageOptions struct {
+	PerPage int // Items per request, as many as possible if 0.
+	Limit   int // Stop after this many items, no limit if 0.
+}
+
+// Paginate returns an iterator over the items of the paginated list at uri.
+// Pages are fetched as the iteration reaches them, so stopping early saves
+// requests. An error ends the iteration.
+func Paginate[T any](c Client, uri string, opts PageOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		perPage := opts.PerPage
+		if perPage <= 0 {
+			perPage = maxPerPage
+			if opts.Limit > 0 && opts.Limit < perPage {
+				perPage = opts.Limit
+			}
+		}
+		u, err := url.Parse(uri)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		v := u.Query()
+		v.Set("per_page", strconv.Itoa(perPage))
+		u.RawQuery = v.Encode()
+
+		n := 0
+		for next := u.String(); next != ""; {
+			resp, err := c.getPage(next)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			vprintln("GET", resp.Request.URL, "->", resp.Status)
+			var items []T
+			err = json.NewDecoder(resp.Body).Decode(&items)
+			resp.Body.Close()
+			if err != nil {
+				yield(zero, fmt.Errorf("error while reading response, %w", err))
+				return
+			}
+			next = nextLink(linkheader.Parse(resp.Header.Get("Link")))
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+				if n++; opts.Limit > 0 && n >= opts.Limit {
+					return
+				}
+			}
+		}
+	}
+}
+
+// All collects the items of seq, or returns the first error.
+func All[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var items []T
+	for item, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
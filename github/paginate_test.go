@@ -0,0 +1,87 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	var requests []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		// 5 items in total.
+		first := (page-1)*perPage + 1
+		last := min(first+perPage-1, 5)
+		if last < 5 {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?per_page=%d&page=%d>; rel="next"`, srv.URL, perPage, page+1))
+		}
+		fmt.Fprint(w, "[")
+		for i := first; i <= last; i++ {
+			if i > first {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"id": %d}`, i)
+		}
+		fmt.Fprint(w, "]")
+	}))
+	defer srv.Close()
+
+	c := NewClient("", "s3cr3t", nil)
+	c.SetBaseURL(srv.URL)
+	type item struct{ Id int }
+	ids := func(items []item) []int {
+		var ids []int
+		for _, it := range items {
+			ids = append(ids, it.Id)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		opts     PageOptions
+		want     []int
+		requests []string
+	}{
+		{PageOptions{}, []int{1, 2, 3, 4, 5}, []string{"per_page=100"}},
+		{PageOptions{PerPage: 2}, []int{1, 2, 3, 4, 5}, []string{"per_page=2", "per_page=2&page=2", "per_page=2&page=3"}},
+		{PageOptions{PerPage: 2, Limit: 3}, []int{1, 2, 3}, []string{"per_page=2", "per_page=2&page=2"}},
+		{PageOptions{Limit: 2}, []int{1, 2}, []string{"per_page=2"}},
+	}
+	for _, tt := range tests {
+		requests = nil
+		items, err := All(Paginate[item](c, "/items", tt.opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(items); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.opts, got, tt.want)
+		}
+		if !reflect.DeepEqual(requests, tt.requests) {
+			t.Errorf("%+v: requested %q, want %q", tt.opts, requests, tt.requests)
+		}
+	}
+
+	// Stopping early doesn't fetch more pages.
+	requests = nil
+	for it, err := range Paginate[item](c, "/items", PageOptions{PerPage: 2}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Id == 2 {
+			break
+		}
+	}
+	if len(requests) != 1 {
+		t.Errorf("requested %q, want only the first page", requests)
+	}
+}
@@ -0,0 +1,129 @@
+package github
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitWait is how long a request may wait in total for a rate limit
+// to reset before the rate limit error is returned. Zero returns it right
+// away.
+var RateLimitWait = 10 * time.Minute
+
+// How long to wait after hitting a secondary rate limit when Github doesn't
+// say, as recommended by its documentation.
+const secondaryRateLimitWait = time.Minute
+
+// Replaced in tests.
+var (
+	now   = time.Now
+	sleep = time.Sleep
+)
+
+// RateLimitError is returned when Github refused a request for exceeding a
+// rate limit, and it wasn't worth waiting for it to reset.
+type RateLimitError struct {
+	*APIError
+	Reset time.Time // When the request may succeed again.
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v (rate limited until %s)", e.APIError, e.Reset.Format("15:04:05"))
+}
+
+func (e *RateLimitError) Unwrap() error { return e.APIError }
+
+// rateLimitDelay reports whether resp, with the given body, refuses a
+// request for exceeding a rate limit and if so, how long to wait before
+// trying again.
+func rateLimitDelay(resp *http.Response, body []byte) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(s); err == nil {
+			return nonNegative(t.Sub(now())), true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			// The reset time has a resolution of seconds, and our clock
+			// may be a little ahead of Github's.
+			return nonNegative(time.Unix(reset, 0).Sub(now())) + time.Second, true
+		}
+	}
+	// Secondary rate limits don't necessarily come with headers, but with
+	// a message. Any other 403 is about permissions.
+	if resp.StatusCode == http.StatusTooManyRequests || bytes.Contains(bytes.ToLower(body), []byte("rate limit")) {
+		return secondaryRateLimitWait, true
+	}
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// peekBody reads the body of resp, which is left in place to be read
+// again. Error responses are small, the body is cut off after 64 KiB.
+func peekBody(resp *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+// logQuota prints how much of the rate limit is left, if resp says so.
+func logQuota(resp *http.Response) {
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		return
+	}
+	reset := ""
+	if secs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		reset = ", resets at " + time.Unix(secs, 0).Format("15:04:05")
+	}
+	vprintf("rate limit: %s of %s requests remaining%s\n", remaining, resp.Header.Get("X-RateLimit-Limit"), reset)
+}
+
+// sendWaiting sends r with send. If Github refuses it for exceeding a rate
+// limit, it waits for the limit to reset and sends it again, for as long as
+// RateLimitWait allows. A request whose body can't be replayed is not sent
+// again.
+func sendWaiting(r *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	var waited time.Duration
+	for {
+		resp, err := send(r)
+		if err != nil {
+			return nil, err
+		}
+		logQuota(resp)
+		if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		wait, limited := rateLimitDelay(resp, peekBody(resp))
+		if !limited || waited+wait > RateLimitWait || (r.Body != nil && r.GetBody == nil) {
+			return resp, nil
+		}
+		if r.GetBody != nil {
+			if r.Body, err = r.GetBody(); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		resp.Body.Close()
+		vprintf("rate limited (%s), waiting %v before sending %s %s again\n", resp.Status, wait.Round(time.Millisecond), r.Method, r.URL)
+		sleep(wait)
+		waited += wait
+	}
+}
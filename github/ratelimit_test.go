@@ -0,0 +1,93 @@
+package github
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitDelay(t *testing.T) {
+	base := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now = func() time.Time { return base }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		status  int
+		headers map[string]string
+		body    string
+		want    time.Duration
+		limited bool
+	}{
+		{403, map[string]string{"Retry-After": "30"}, "", 30 * time.Second, true},
+		{429, map[string]string{"Retry-After": base.Add(time.Minute).Format(http.TimeFormat)}, "", time.Minute, true},
+		{403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(base.Unix()+10, 10)}, "", 11 * time.Second, true},
+		{403, nil, `{"message": "You have exceeded a secondary rate limit."}`, secondaryRateLimitWait, true},
+		{429, nil, "", secondaryRateLimitWait, true},
+		{403, map[string]string{"X-RateLimit-Remaining": "4999"}, `{"message": "Resource not accessible by integration"}`, 0, false},
+		{404, map[string]string{"Retry-After": "30"}, "", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		for k, v := range tt.headers {
+			resp.Header.Set(k, v)
+		}
+		got, limited := rateLimitDelay(resp, []byte(tt.body))
+		if got != tt.want || limited != tt.limited {
+			t.Errorf("%d %v %q: got %v, %v, want %v, %v", tt.status, tt.headers, tt.body, got, limited, tt.want, tt.limited)
+		}
+	}
+}
+
+func TestSendWaiting(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	limited := 2
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if limited > 0 {
+			limited--
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "You have exceeded a secondary rate limit."}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c := NewClient("", "s3cr3t", nil)
+	c.SetBaseURL(srv.URL)
+	err := c.send("POST", "/repos/o/r/releases", map[string]string{"tag_name": "v1"}, http.StatusCreated, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slept) != 2 || slept[0] != 5*time.Second {
+		t.Errorf("slept %v, want twice 5s", slept)
+	}
+	for _, b := range bodies {
+		if b != `{"tag_name":"v1"}` {
+			t.Errorf("request body not replayed: %q", bodies)
+		}
+	}
+
+	// Don't wait longer than allowed.
+	defer func(d time.Duration) { RateLimitWait = d }(RateLimitWait)
+	RateLimitWait = 7 * time.Second
+	limited, slept = 2, nil
+	err = c.send("POST", "/repos/o/r/releases", map[string]string{"tag_name": "v1"}, http.StatusCreated, nil)
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) || rlErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("want a RateLimitError, got %v", err)
+	}
+	if len(slept) != 1 {
+		t.Errorf("slept %v, want once", slept)
+	}
+}
@@ -0,0 +1,94 @@
+package github
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// Secrets shorter than this are not redacted, they would mangle too much
+// else.
+const minSecretLen = 8
+
+// Tokens Github issues have recognizable prefixes, so that they are redacted
+// even if they were never registered with AddSecret.
+var tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+
+// Query parameters of pre-signed URLs, such as the ones asset downloads are
+// redirected to, that grant access by themselves.
+var signedParams = []string{
+	"X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token",
+	"X-Goog-Signature", "X-Goog-Credential",
+	"Signature", "sig", "jwt", "token", "access_token",
+}
+
+var signedParamPattern = func() *regexp.Regexp {
+	names := make([]string, len(signedParams))
+	for i, name := range signedParams {
+		names[i] = regexp.QuoteMeta(name)
+	}
+	// The separator may be escaped, in HTML or in JSON.
+	return regexp.MustCompile(`(?i)((?:&amp;|\\u0026|[?&])(?:` + strings.Join(names, "|") + `)=)[^&#\s"'<>\\]*`)
+}()
+
+// isSignedParam reports whether the query parameter name is one of
+// signedParams.
+func isSignedParam(name string) bool {
+	for _, p := range signedParams {
+		if strings.EqualFold(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers whose values are replaced entirely.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+var secrets struct {
+	sync.Mutex
+	list []string
+}
+
+// AddSecret makes Redact remove s from now on.
+func AddSecret(s string) {
+	if len(s) < minSecretLen {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, known := range secrets.list {
+		if known == s {
+			return
+		}
+	}
+	secrets.list = append(secrets.list, s)
+}
+
+// Redact replaces the secrets registered with AddSecret, anything that
+// looks like a Github token and the signatures of pre-signed URLs in s.
+func Redact(s string) string {
+	secrets.Lock()
+	for _, secret := range secrets.list {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	secrets.Unlock()
+	s = signedParamPattern.ReplaceAllString(s, "${1}"+redacted)
+	return tokenPattern.ReplaceAllString(s, redacted)
+}
+
+// redactHeader returns the value of the header name, redacted.
+func redactHeader(name, value string) string {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return redacted
+	}
+	return Redact(value)
+}
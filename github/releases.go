@@ -0,0 +1,297 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	releaseListURI   = "/repos/%s/%s/releases"
+	releaseURI       = "/repos/%s/%s/releases/%d"
+	releaseTagURI    = "/repos/%s/%s/releases/tags/%s"
+	assetURI         = "/repos/%s/%s/releases/assets/%d"
+	releaseAssetsURI = "/repos/%s/%s/releases/%d/assets"
+)
+
+type Release struct {
+	Url         string     `json:"url"`
+	PageUrl     string     `json:"html_url"`
+	UploadUrl   string     `json:"upload_url"`
+	Id          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"body"`
+	TagName     string     `json:"tag_name"`
+	Target      string     `json:"target_commitish"`
+	Draft       bool       `json:"draft"`
+	Prerelease  bool       `json:"prerelease"`
+	Created     *time.Time `json:"created_at"`
+	Published   *time.Time `json:"published_at"`
+	Assets      []Asset    `json:"assets"`
+}
+
+// CleanUploadUrl returns the upload URL of the release without the URI
+// template suffix ({?name,label}).
+func (r *Release) CleanUploadUrl() string {
+	bracket := strings.Index(r.UploadUrl, "{")
+
+	if bracket == -1 {
+		return r.UploadUrl
+	}
+
+	return r.UploadUrl[0:bracket]
+}
+
+// ReleaseCreate holds the parameters of a release to create or update.
+type ReleaseCreate struct {
+	TagName              string `json:"tag_name"`
+	TargetCommitish      string `json:"target_commitish,omitempty"`
+	Name                 string `json:"name"`
+	Body                 string `json:"body"`
+	Draft                bool   `json:"draft"`
+	Prerelease           bool   `json:"prerelease"`
+	GenerateReleaseNotes bool   `json:"generate_release_notes"`
+}
+
+type Asset struct {
+	Url         string    `json:"url"`
+	Id          int       `json:"id"`
+	Name        string    `json:"name"`
+	Label       string    `json:"label"`
+	ContentType string    `json:"content_type"`
+	State       string    `json:"state"`
+	Size        uint64    `json:"size"`
+	Digest      string    `json:"digest"`
+	Downloads   uint64    `json:"download_count"`
+	Created     time.Time `json:"created_at"`
+	Published   time.Time `json:"published_at"`
+	Updated     time.Time `json:"updated_at"`
+}
+
+// Release returns the release with the given id.
+func (c Client) Release(owner, repo string, id int) (*Release, error) {
+	var release Release
+	if err := c.Get(fmt.Sprintf(releaseURI, owner, repo, id), &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// ReleaseByTag returns the published release of tag. Github doesn't find
+// drafts this way, as they aren't bound to their tag until published.
+func (c Client) ReleaseByTag(owner, repo, tag string) (*Release, error) {
+	var release Release
+	if err := c.Get(fmt.Sprintf(releaseTagURI, owner, repo, url.PathEscape(tag)), &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// CreateRelease creates a release in the repository owner/repo and returns
+// it as created by Github.
+func (c Client) CreateRelease(owner, repo string, params ReleaseCreate) (*Release, error) {
+	var release Release
+	err := c.send("POST", fmt.Sprintf(releaseListURI, owner, repo), params, http.StatusCreated, &release)
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// UpdateRelease changes the release with the given id and returns it as
+// updated by Github.
+func (c Client) UpdateRelease(owner, repo string, id int, params ReleaseCreate) (*Release, error) {
+	var release Release
+	err := c.send("PATCH", fmt.Sprintf(releaseURI, owner, repo, id), params, http.StatusOK, &release)
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// DeleteRelease deletes the release with the given id, leaving its tag in
+// place.
+func (c Client) DeleteRelease(owner, repo string, id int) error {
+	return c.send("DELETE", fmt.Sprintf(releaseURI, owner, repo, id), nil, http.StatusNoContent, nil)
+}
+
+// Releases iterates over the releases of the repository owner/repo, most
+// recent first, drafts included.
+func (c Client) Releases(owner, repo string, opts PageOptions) iter.Seq2[Release, error] {
+	return Paginate[Release](c, fmt.Sprintf(releaseListURI, owner, repo), opts)
+}
+
+// Assets iterates over the assets of the release with the given id,
+// including incomplete uploads, which the assets embedded in a Release
+// omit.
+func (c Client) Assets(owner, repo string, id int, opts PageOptions) iter.Seq2[Asset, error] {
+	return Paginate[Asset](c, fmt.Sprintf(releaseAssetsURI, owner, repo, id), opts)
+}
+
+// ListAssets returns all assets of the release with the given id, see
+// Assets.
+func (c Client) ListAssets(owner, repo string, id int) ([]Asset, error) {
+	return All(c.Assets(owner, repo, id, PageOptions{}))
+}
+
+// UpdateAsset changes the name and label of the asset with the given id
+// and returns it as updated by Github.
+func (c Client) UpdateAsset(owner, repo string, id int, name, label string) (*Asset, error) {
+	params := struct {
+		Name  string `json:"name"`
+		Label string `json:"label"`
+	}{name, label}
+	var asset Asset
+	err := c.send("PATCH", fmt.Sprintf(assetURI, owner, repo, id), params, http.StatusOK, &asset)
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// DeleteAsset deletes the asset with the given id.
+func (c Client) DeleteAsset(owner, repo string, id int) error {
+	return c.send("DELETE", fmt.Sprintf(assetURI, owner, repo, id), nil, http.StatusNoContent, nil)
+}
+
+// UploadAsset uploads size bytes from body as an asset called name to
+// uploadURL, the upload URL of a release without the URI template suffix
+// (see Release.CleanUploadUrl).
+//
+// If Github fails to store the upload, it may still create the asset in
+// state "new" and describe it in a 502 Bad Gateway response. Such an asset
+// is returned along with the *APIError, so that the caller can remove it.
+func (c Client) UploadAsset(uploadURL, name, label string, body io.Reader, size int64) (*Asset, error) {
+	v := url.Values{}
+	v.Set("name", name)
+	if label != "" {
+		v.Set("label", label)
+	}
+	req, err := c.NewRequest("POST", uploadURL+"?"+v.Encode(), sizedReader{body, size})
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	if VERBOSITY > 0 {
+		vprintf("ASSET: ")
+		r = io.TeeReader(r, os.Stderr)
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		var asset Asset
+		if err := json.NewDecoder(r).Decode(&asset); err != nil {
+			return nil, fmt.Errorf("could not decode uploaded asset: %v", err)
+		}
+		return &asset, nil
+	case http.StatusBadGateway:
+		b, _ := io.ReadAll(io.LimitReader(r, maxErrorBody))
+		apiErr := newAPIError(resp, b)
+		var asset Asset
+		if err := json.Unmarshal(b, &asset); err != nil || asset.Id == 0 {
+			return nil, apiErr
+		}
+		return &asset, apiErr
+	}
+	return nil, parseError(resp)
+}
+
+// DownloadAsset requests the contents of the asset with the given id,
+// starting at byte offset. The response is either 200 OK or, for
+// offset > 0, possibly 206 Partial Content; the caller is responsible for
+// closing its body.
+func (c Client) DownloadAsset(owner, repo string, id int, offset int64) (*http.Response, error) {
+	return c.Download(fmt.Sprintf(assetURI, owner, repo, id), offset)
+}
+
+// Download is like DownloadAsset for any URL serving a file, such as the
+// browser download URL of an asset.
+func (c Client) Download(uri string, offset int64) (*http.Response, error) {
+	req, err := c.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	vprintln("GET", resp.Request.URL, "->", resp.Status)
+	if resp.StatusCode != http.StatusOK && (offset == 0 || resp.StatusCode != http.StatusPartialContent) {
+		return nil, parseError(resp)
+	}
+	return resp, nil
+}
+
+// send sends params (unless nil) as JSON and decodes the response into v
+// (unless nil). Any status other than want is an error.
+func (c Client) send(method, uri string, params interface{}, want int, v interface{}) error {
+	var body io.Reader
+	var payload []byte
+	if params != nil {
+		var err error
+		if payload, err = json.Marshal(params); err != nil {
+			return fmt.Errorf("can't encode request, %v", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := c.NewRequest(method, uri, body)
+	if err != nil {
+		return err
+	}
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		if payload != nil {
+			vprintf("while submitting %s\n", payload)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	vprintln("RESPONSE:", resp.Status)
+
+	if resp.StatusCode != want {
+		return parseError(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	var r io.Reader = resp.Body
+	if VERBOSITY > 0 {
+		vprintf("BODY: ")
+		r = io.TeeReader(r, os.Stderr)
+	}
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("error while reading response, %w", err)
+	}
+	return nil
+}
+
+// sizedReader is an io.Reader of known length.
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (r sizedReader) Size() int64 { return r.size }
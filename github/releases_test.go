@@ -0,0 +1,78 @@
+package github
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadAsset(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "app.tar.gz" || r.URL.Query().Get("label") != "App" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		if r.ContentLength != 5 {
+			t.Errorf("Content-Length = %d, want 5", r.ContentLength)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id": 3, "name": "app.tar.gz", "state": "new"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("", "s3cr3t", nil)
+	c.SetBaseURL(srv.URL)
+
+	status = http.StatusCreated
+	asset, err := c.UploadAsset(srv.URL+"/repos/o/r/releases/1/assets", "app.tar.gz", "App", strings.NewReader("hello"), 5)
+	if err != nil || asset.Id != 3 {
+		t.Fatalf("upload: %+v, %v", asset, err)
+	}
+
+	// A failed upload may leave an asset behind, which is returned so that
+	// it can be cleaned up.
+	status = http.StatusBadGateway
+	asset, err = c.UploadAsset(srv.URL+"/repos/o/r/releases/1/assets", "app.tar.gz", "App", strings.NewReader("hello"), 5)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("want a 502 APIError, got %v", err)
+	}
+	if asset == nil || asset.Id != 3 {
+		t.Errorf("want the incomplete asset, got %+v", asset)
+	}
+}
+
+func TestSendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("", "s3cr3t", nil)
+	c.SetBaseURL(srv.URL)
+	err := c.DeleteRelease("o", "r", 1)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Not Found" {
+		t.Fatalf("want a 404 APIError with message, got %#v", err)
+	}
+}
+
+func TestReleaseByTag(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/releases/tags/v1.0.0" || r.URL.RawQuery != "" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"id": 1, "tag_name": "v1.0.0"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient("", "s3cr3t", nil)
+	c.SetBaseURL(srv.URL)
+	rel, err := c.ReleaseByTag("o", "r", "v1.0.0")
+	if err != nil || rel.Id != 1 || rel.TagName != "v1.0.0" {
+		t.Errorf("got %+v, %v", rel, err)
+	}
+}
@@ -0,0 +1,329 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Bodies are cut off after this many bytes in traces.
+const traceMaxBody = 64 << 10
+
+// Tracer records every request and its response, as a HAR archive or as
+// JSON lines holding one HAR entry each. Credentials are redacted, see
+// Redact.
+type Tracer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	har     bool
+	entries []harEntry
+}
+
+// NewTracer returns a Tracer writing to w. JSON lines are written as the
+// responses are read, a HAR archive only by Flush.
+func NewTracer(w io.Writer, har bool) *Tracer {
+	return &Tracer{w: w, har: har}
+}
+
+// Flush writes the HAR archive, if that is what t records.
+func (t *Tracer) Flush() error {
+	if !t.har {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := t.entries
+	if entries == nil {
+		entries = []harEntry{}
+	}
+	var log harLog
+	log.Log.Version = "1.2"
+	log.Log.Creator.Name = "github-release"
+	log.Log.Creator.Version = VERSION
+	log.Log.Entries = entries
+	enc := json.NewEncoder(t.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+func (t *Tracer) record(e harEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.har {
+		t.entries = append(t.entries, e)
+		return
+	}
+	if err := json.NewEncoder(t.w).Encode(e); err != nil {
+		vprintln("could not write trace:", err)
+	}
+}
+
+// The subset of HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/)
+// we fill in.
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // Milliseconds.
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	QueryString []harHeader `json:"queryString"`
+	Cookies     []harHeader `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	PostData    *harContent `json:"postData,omitempty"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []harHeader `json:"headers"`
+	Cookies     []harHeader `json:"cookies"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(h http.Header) []harHeader {
+	headers := []harHeader{}
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harHeader{name, redactHeader(name, v)})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// captureBody keeps the first traceMaxBody bytes read through it.
+type captureBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	size int64
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := traceMaxBody - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// content describes what went through b, redacted. Binary data is only
+// described by its size.
+func (b *captureBody) content(mimeType string) harContent {
+	c := harContent{Size: b.size, MimeType: mimeType}
+	switch {
+	case b.size == 0:
+	case !utf8.Valid(b.buf.Bytes()):
+		c.Text = fmt.Sprintf("<%d bytes>", b.size)
+	case b.size > int64(b.buf.Len()):
+		c.Text = Redact(b.buf.String()) + fmt.Sprintf("... <%d bytes>", b.size)
+	default:
+		c.Text = Redact(b.buf.String())
+	}
+	return c
+}
+
+// tracingTransport records the requests going through it with a Tracer.
+type tracingTransport struct {
+	http.RoundTripper
+	tracer *Tracer
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	p := &pendingEntry{tracer: t.tracer, pending: 1}
+	p.e.StartedDateTime = start
+	u := *req.URL
+	u.User = nil
+	p.e.Request = harRequest{
+		Method:      req.Method,
+		URL:         Redact(u.String()),
+		HTTPVersion: req.Proto,
+		Headers:     harHeaders(req.Header),
+		QueryString: []harHeader{},
+		Cookies:     []harHeader{},
+		HeadersSize: -1,
+	}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			if isSignedParam(name) {
+				v = redacted
+			}
+			p.e.Request.QueryString = append(p.e.Request.QueryString, harHeader{name, Redact(v)})
+		}
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		// The transport may still be sending the body after RoundTrip
+		// returns, e.g. if Github answers an upload early. It is only
+		// complete once the transport closes it.
+		p.pending++
+		body := &requestBody{captureBody: captureBody{ReadCloser: req.Body}}
+		mimeType := req.Header.Get("Content-Type")
+		body.done = func() {
+			p.done(func(e *harEntry) {
+				e.Request.BodySize = body.size
+				if body.size > 0 {
+					content := body.content(mimeType)
+					e.Request.PostData = &content
+				}
+			})
+		}
+		clone := *req
+		clone.Body = body
+		req = &clone
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	wait := millis(time.Since(start))
+	if err != nil {
+		p.done(func(e *harEntry) {
+			e.Timings.Wait = wait
+			e.Time = wait
+			e.Error = Redact(err.Error())
+			e.Response = harResponse{Headers: []harHeader{}, Cookies: []harHeader{}, HeadersSize: -1, BodySize: -1}
+		})
+		return nil, err
+	}
+
+	response := harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harHeader{},
+		RedirectURL: Redact(resp.Header.Get("Location")),
+		HeadersSize: -1,
+	}
+	received := time.Now()
+	body := &tracedBody{captureBody: captureBody{ReadCloser: resp.Body}}
+	body.done = func() {
+		p.done(func(e *harEntry) {
+			e.Timings.Wait = wait
+			e.Timings.Receive = millis(time.Since(received))
+			e.Time = e.Timings.Wait + e.Timings.Receive
+			e.Response = response
+			e.Response.Content = body.content(resp.Header.Get("Content-Type"))
+			e.Response.BodySize = body.size
+		})
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// pendingEntry is a trace entry that is completed by the response and by
+// the request body, if there is one, in either order. It is recorded once
+// both are done.
+type pendingEntry struct {
+	mu      sync.Mutex
+	e       harEntry
+	pending int
+	tracer  *Tracer
+}
+
+// done applies fill to the entry and records it if that was the last part
+// missing.
+func (p *pendingEntry) done(fill func(e *harEntry)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fill(&p.e)
+	if p.pending--; p.pending == 0 {
+		p.tracer.record(p.e)
+	}
+}
+
+// requestBody is a request body that completes its part of the trace entry
+// once the transport closes it, which it always does.
+type requestBody struct {
+	mu sync.Mutex // The transport may close the body while it is read.
+	captureBody
+	once sync.Once
+	done func()
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.captureBody.Read(p)
+}
+
+func (b *requestBody) Close() error {
+	err := b.captureBody.Close()
+	b.once.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.done()
+	})
+	return err
+}
+
+// tracedBody is a response body that completes its trace entry once it is
+// closed, by which time all secrets it may contain are known.
+type tracedBody struct {
+	captureBody
+	once sync.Once
+	done func()
+}
+
+func (b *tracedBody) Close() error {
+	// Responses are often closed unread when only the status matters, but
+	// the body is part of the trace.
+	if room := traceMaxBody - b.buf.Len(); room > 0 {
+		io.CopyN(io.Discard, &b.captureBody, int64(room))
+	}
+	err := b.captureBody.Close()
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,172 @@
+package github
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPOptions configure the connections of all requests, see
+// SetHTTPOptions.
+type HTTPOptions struct {
+	CACert     string // PEM file of CA certificates to trust besides the system ones.
+	ClientCert string // PEM file of a certificate to present, for mutual TLS.
+	ClientKey  string // PEM file of its private key, if it isn't in ClientCert.
+
+	ConnectTimeout time.Duration // For connecting, including the TLS handshake.
+	ReadTimeout    time.Duration // For the response to start, then for each read of its body.
+	Deadline       time.Time     // Requests are cut off at this point in time.
+
+	Tracer *Tracer // Records all requests, if not nil.
+}
+
+// timeoutError is returned when a request takes too long. Like the errors
+// of net/http, it is a net.Error.
+type timeoutError string
+
+func (e timeoutError) Error() string   { return string(e) }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return false }
+
+const errDeadline = timeoutError("overall deadline exceeded")
+
+// SetHTTPOptions makes all requests, to the API as well as uploads and
+// downloads, use connections configured by o. Zero values keep the
+// defaults of net/http, which means no timeouts.
+func SetHTTPOptions(o HTTPOptions) error {
+	tlsConfig, err := o.tlsConfig()
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if o.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: o.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = o.ConnectTimeout
+	}
+	transport.ResponseHeaderTimeout = o.ReadTimeout
+
+	var rt http.RoundTripper = &timeoutTransport{transport, o.ReadTimeout, o.Deadline}
+	if o.Tracer != nil {
+		rt = &tracingTransport{rt, o.Tracer}
+	}
+	defaultHttpClient = &http.Client{Transport: rt}
+	return nil
+}
+
+func (o HTTPOptions) tlsConfig() (*tls.Config, error) {
+	if o.CACert == "" && o.ClientCert == "" && o.ClientKey == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if o.CACert != "" {
+		pem, err := os.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificates: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			vprintln("could not load the system CA certificates:", err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM encoded certificates found", o.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if o.ClientKey != "" && o.ClientCert == "" {
+		return nil, fmt.Errorf("a client key was given without a client certificate")
+	}
+	if o.ClientCert != "" {
+		key := o.ClientKey
+		if key == "" {
+			key = o.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// timeoutTransport applies the read timeout to response bodies, which
+// http.Transport doesn't, and the deadline to everything.
+type timeoutTransport struct {
+	http.RoundTripper
+	readTimeout time.Duration
+	deadline    time.Time
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.deadline.IsZero() {
+		ctx, cancel = context.WithCancel(req.Context())
+	} else {
+		ctx, cancel = context.WithDeadline(req.Context(), t.deadline)
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = errDeadline
+		}
+		cancel()
+		return nil, err
+	}
+	body := &timeoutBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, timeout: t.readTimeout}
+	if t.readTimeout > 0 {
+		body.timer = time.AfterFunc(t.readTimeout, func() {
+			body.expired.Store(true)
+			cancel()
+		})
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// timeoutBody is a response body that is cut off once no data arrived for
+// the timeout.
+type timeoutBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.timer != nil && !b.expired.Load() {
+		b.timer.Reset(b.timeout)
+	}
+	if err != nil && err != io.EOF {
+		switch {
+		case b.expired.Load():
+			err = timeoutError(fmt.Sprintf("no data received for %v", b.timeout))
+		case b.ctx.Err() == context.DeadlineExceeded:
+			err = errDeadline
+		}
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,147 @@
+package github
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to
+// dir and returns their paths.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "release-bot"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, certFile, keyFile
+}
+
+func TestSetHTTPOptionsTLS(t *testing.T) {
+	defer func(c *http.Client) { defaultHttpClient = c }(defaultHttpClient)
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "release-bot" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+
+	get := func() error {
+		c := NewClient("", "s3cr3t", nil)
+		c.SetBaseURL(srv.URL)
+		var v struct{ Id int }
+		return c.Get("/repos/o/r/releases/latest", &v)
+	}
+
+	if err := SetHTTPOptions(HTTPOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(); err == nil {
+		t.Error("server certificate accepted without --cacert")
+	}
+	if err := SetHTTPOptions(HTTPOptions{CACert: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(); err == nil {
+		t.Error("request went through without client certificate")
+	}
+	if err := SetHTTPOptions(HTTPOptions{CACert: caFile, ClientCert: certFile, ClientKey: keyFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(); err != nil {
+		t.Errorf("with CA and client certificate: %v", err)
+	}
+
+	if err := SetHTTPOptions(HTTPOptions{CACert: keyFile}); err == nil {
+		t.Error("key accepted as CA certificate")
+	}
+	if err := SetHTTPOptions(HTTPOptions{ClientKey: keyFile}); err == nil {
+		t.Error("client key accepted without certificate")
+	}
+}
+
+func TestSetHTTPOptionsTimeouts(t *testing.T) {
+	defer func(c *http.Client) { defaultHttpClient = c }(defaultHttpClient)
+
+	stall := make(chan struct{})
+	defer close(stall)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	download := func() error {
+		resp, err := NewClient("", "", nil).Download(srv.URL+"/asset", 0)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		return err
+	}
+
+	if err := SetHTTPOptions(HTTPOptions{ReadTimeout: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := download(); err == nil || !strings.Contains(err.Error(), "no data received") {
+		t.Errorf("stalled download: %v", err)
+	}
+
+	if err := SetHTTPOptions(HTTPOptions{Deadline: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := download(); err != errDeadline {
+		t.Errorf("download past the deadline: %v", err)
+	}
+	if err := download(); err == nil || !strings.Contains(err.Error(), errDeadline.Error()) {
+		t.Errorf("request after the deadline: %v", err)
+	}
+}
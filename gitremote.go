@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findGitConfig returns the path of the config file of the git repository
+// the working directory is in.
+func findGitConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		gitDir := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(gitDir); err == nil {
+			if !fi.IsDir() {
+				// Worktrees and submodules have a .git file pointing to
+				// the actual git directory.
+				if gitDir, err = readGitDirFile(gitDir); err != nil {
+					return "", err
+				}
+			}
+			// Worktrees share the config of the main repository.
+			if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				path := strings.TrimSpace(string(common))
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(gitDir, path)
+				}
+				gitDir = path
+			}
+			return filepath.Join(gitDir, "config"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("not in a git repository")
+		}
+		dir = parent
+	}
+}
+
+// readGitDirFile returns the git directory a .git file points to.
+func readGitDirFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("%s does not point to a git directory", path)
+	}
+	dir = strings.TrimSpace(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+	return dir, nil
+}
+
+// gitRemoteURL returns the URL of the remote called name in the git config
+// file at path. Only the subset of the format git itself writes for
+// remotes is understood.
+func gitRemoteURL(path, name string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	section := fmt.Sprintf("remote %q", name)
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end == -1 {
+				return "", fmt.Errorf("%s: malformed section %q", path, line)
+			}
+			// Section names are case-insensitive, subsections aren't.
+			head := line[1:end]
+			if i := strings.IndexByte(head, ' '); i != -1 {
+				head = strings.ToLower(head[:i]) + head[i:]
+			}
+			inSection = head == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		if strings.ToLower(strings.TrimSpace(key)) == "url" {
+			return strings.Trim(strings.TrimSpace(value), `"`), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no remote %q in %s", name, path)
+}
+
+// parseRemoteURL extracts the owner and name of a repository from the URL
+// of a remote on github.com or a Github Enterprise host, in any of the
+// forms git accepts:
+//
+//	https://github.com/aktau/gofinance.git
+//	ssh://git@github.example.com:2222/aktau/gofinance.git
+//	git@github.com:aktau/gofinance.git
+func parseRemoteURL(remote string) (user, repo string, err error) {
+	var path string
+	if u, perr := url.Parse(remote); perr == nil && u.Scheme != "" && u.Host != "" {
+		path = u.Path
+	} else if i := strings.Index(remote, ":"); i != -1 && !strings.Contains(remote[:i], "/") {
+		// The scp-like syntax: [user@]host:path
+		path = remote[i+1:]
+	} else {
+		return "", "", fmt.Errorf("unsupported remote URL %q", remote)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", fmt.Errorf("remote URL %q does not name a repository", remote)
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// inferFromRemote fills in EnvUser and EnvRepo from the remote called name
+// of the git repository in the working directory, if they are still unset,
+// see inferPair. Not being in a repository with such a remote is not an
+// error.
+func inferFromRemote(name string) {
+	if EnvUser != "" && EnvRepo != "" {
+		return
+	}
+	path, err := findGitConfig()
+	if err != nil {
+		vprintln("not inferring user and repo from a git remote:", err)
+		return
+	}
+	remote, err := gitRemoteURL(path, name)
+	if err != nil {
+		vprintln("not inferring user and repo from a git remote:", err)
+		return
+	}
+	user, repo, err := parseRemoteURL(remote)
+	if err != nil {
+		vprintln("not inferring user and repo from a git remote:", err)
+		return
+	}
+	vprintf("git remote %s is %s/%s\n", name, user, repo)
+	if !inferPair(&EnvUser, &EnvRepo, user, repo) {
+		vprintf("not inferring user and repo from git remote %s, %s/%s was configured\n",
+			name, nvls(EnvUser, "?"), nvls(EnvRepo, "?"))
+	}
+}
+
+// inferPair fills in the empty ones of *user and *repo with the owner and
+// name of the repository of a remote. Both are taken together: only if
+// what is set already agrees with the remote, so that a configured user is
+// never combined with the name of an unrelated repository. It reports
+// whether the remote was used.
+func inferPair(user, repo *string, remoteUser, remoteRepo string) bool {
+	if (*user != "" && !strings.EqualFold(*user, remoteUser)) ||
+		(*repo != "" && !strings.EqualFold(*repo, remoteRepo)) {
+		return false
+	}
+	*user = nvls(*user, remoteUser)
+	*repo = nvls(*repo, remoteRepo)
+	return true
+}
@@ -3,8 +3,10 @@ module github.com/github-release/github-release
 go 1.23.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/dustin/go-humanize v1.0.1
 	github.com/kevinburke/rest v0.0.0-20250718180114-1a15e4f2364f
 	github.com/tomnomnom/linkheader v0.0.0-20180905144013-02ca5825eb80
 	github.com/voxelbrain/goptions v0.0.0-20180630082107-58cddc247ea2
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	// How often the progress line is redrawn on a terminal.
+	progressTTYInterval = 200 * time.Millisecond
+	// How often a progress line is printed when stderr is not a terminal
+	// (e.g. CI logs), just often enough to show the transfer is alive.
+	progressLogInterval = 10 * time.Second
+)
+
+var (
+	// Set to false to disable progress reporting altogether.
+	showProgress = true
+
+	// Where progress is reported, whether that is a terminal and the clock
+	// it is timed by, replaced in tests.
+	progressOut        io.Writer = os.Stderr
+	progressIsTerminal           = func() bool { return isCharDevice(os.Stderr) }
+	progressClock                = time.Now
+
+	progressMu sync.Mutex // Guards everything below and serializes output.
+	// The unfinished transfers on a terminal. Parallel transfers share a
+	// single line, which is redrawn at most every progressTTYInterval.
+	transfers []*progressReader
+	lastDraw  time.Time
+)
+
+// progressReader reports how much of a transfer has gone through it: as a
+// continuously updated line if progressOut is a terminal, as a plain line
+// every progressLogInterval otherwise.
+type progressReader struct {
+	r    io.Reader
+	name string
+	size int64 // Total size of the transfer, <= 0 if unknown.
+
+	n      int64 // Bytes transferred, including the offset we started at.
+	offset int64
+	start  time.Time
+	last   time.Time
+	tty    bool
+	done   bool
+}
+
+// newProgressReader wraps r, which yields the bytes of name starting at
+// offset out of size. The caller must close it when the transfer is over,
+// whether or not r was read to the end; that doesn't close r. If progress
+// reporting is disabled, r is returned as is.
+func newProgressReader(r io.Reader, name string, offset, size int64) io.ReadCloser {
+	if !showProgress {
+		return io.NopCloser(r)
+	}
+	now := progressClock()
+	p := &progressReader{
+		r:      r,
+		name:   name,
+		size:   size,
+		n:      offset,
+		offset: offset,
+		start:  now,
+		last:   now,
+		tty:    progressIsTerminal(),
+	}
+	if p.tty {
+		progressMu.Lock()
+		transfers = append(transfers, p)
+		progressMu.Unlock()
+	}
+	return p
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	p.n += int64(n)
+	now := progressClock()
+	switch {
+	case p.done:
+	case err == io.EOF || (p.size > 0 && p.n >= p.size):
+		p.done = true
+		if p.tty {
+			p.finish(now)
+		}
+	case p.tty && now.Sub(lastDraw) >= progressTTYInterval:
+		drawTransfers(now)
+	case !p.tty && now.Sub(p.last) >= progressLogInterval:
+		p.last = now
+		fmt.Fprintln(progressOut, p.status(now))
+	}
+	return n, err
+}
+
+// Close ends the report of a transfer that didn't go through completely,
+// e.g. because it failed and will be retried with a new progressReader.
+func (p *progressReader) Close() error {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if p.done {
+		return nil
+	}
+	p.done = true
+	if p.tty {
+		p.remove()
+		if len(transfers) > 0 {
+			drawTransfers(progressClock())
+		} else {
+			fmt.Fprint(progressOut, "\r\033[K")
+		}
+	}
+	return nil
+}
+
+// remove takes p off the list of unfinished transfers. progressMu must be
+// held.
+func (p *progressReader) remove() {
+	for i, t := range transfers {
+		if t == p {
+			transfers = append(transfers[:i], transfers[i+1:]...)
+			return
+		}
+	}
+}
+
+// rate returns the average number of bytes per second transferred since the
+// start.
+func (p *progressReader) rate(now time.Time) float64 {
+	elapsed := now.Sub(p.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.n-p.offset) / elapsed
+}
+
+// status describes the current state of the transfer.
+func (p *progressReader) status(now time.Time) string {
+	return formatProgress(p.name, p.n, p.size, p.rate(now))
+}
+
+// formatProgress describes a transfer of what, n bytes of which out of size
+// have gone through at rate bytes per second.
+func formatProgress(what string, n, size int64, rate float64) string {
+	line := what + ": " + humanize.Bytes(uint64(n))
+	if size > 0 {
+		line += fmt.Sprintf(" / %s (%d%%)", humanize.Bytes(uint64(size)), n*100/size)
+	}
+	if rate > 0 {
+		line += fmt.Sprintf(", %s/s", humanize.Bytes(uint64(rate)))
+		if size > 0 && n < size {
+			eta := time.Duration(float64(size-n) / rate * float64(time.Second))
+			line += fmt.Sprintf(", ETA %v", eta.Round(time.Second))
+		}
+	}
+	return line
+}
+
+// finish replaces the shared line by the final state of the transfer, which
+// stays on screen, and redraws the line of the transfers still going on
+// below it. progressMu must be held.
+func (p *progressReader) finish(now time.Time) {
+	p.remove()
+	// Return to the start of the line and clear it.
+	fmt.Fprint(progressOut, "\r\033[K"+p.status(now)+"\n")
+	if len(transfers) > 0 {
+		drawTransfers(now)
+	}
+}
+
+// drawTransfers redraws the line shared by the unfinished transfers: the
+// state of the transfer if there is only one, their totals otherwise.
+// progressMu must be held.
+func drawTransfers(now time.Time) {
+	lastDraw = now
+	var line string
+	if len(transfers) == 1 {
+		line = transfers[0].status(now)
+	} else {
+		var n, size int64
+		var rate float64
+		for _, t := range transfers {
+			n += t.n
+			if size >= 0 && t.size > 0 {
+				size += t.size
+			} else {
+				size = -1 // Unknown if any one of them is.
+			}
+			rate += t.rate(now)
+		}
+		line = formatProgress(fmt.Sprintf("%d transfers", len(transfers)), n, size, rate)
+	}
+	fmt.Fprint(progressOut, "\r\033[K"+line)
+}
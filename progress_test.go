@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProgress reports progress to a buffer, as if it was a terminal if
+// tty is set, timed by a clock that only moves when the test says so, until
+// the test ends.
+func fakeProgress(t *testing.T, tty bool) (*bytes.Buffer, *time.Time) {
+	var out bytes.Buffer
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	show, w, terminal, clock := showProgress, progressOut, progressIsTerminal, progressClock
+	t.Cleanup(func() {
+		showProgress, progressOut, progressIsTerminal, progressClock, transfers = show, w, terminal, clock, nil
+	})
+	showProgress, progressOut, progressClock = true, &out, func() time.Time { return now }
+	progressIsTerminal = func() bool { return tty }
+	return &out, &now
+}
+
+func TestProgressLog(t *testing.T) {
+	out, now := fakeProgress(t, false)
+	r := newProgressReader(strings.NewReader(strings.Repeat("x", 6000)), "a.zip", 0, 6000)
+	first := "a.zip: 3.0 kB / 6.0 kB (50%), 300 B/s, ETA 10s\n"
+	second := "a.zip: 5.0 kB / 6.0 kB (83%), 250 B/s, ETA 4s\n"
+
+	b := make([]byte, 1000)
+	steps := []struct {
+		advance time.Duration
+		want    string // The output after reading the next 1000 bytes.
+	}{
+		{1 * time.Second, ""},
+		{8 * time.Second, ""},
+		{1 * time.Second, first},
+		{9 * time.Second, first},
+		{1 * time.Second, first + second},
+		// The end of the transfer isn't logged, only that it goes on.
+		{time.Minute, first + second},
+	}
+	for i, step := range steps {
+		*now = now.Add(step.advance)
+		if _, err := r.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != step.want {
+			t.Errorf("after %d reads got output %q, want %q", i+1, out.String(), step.want)
+		}
+	}
+	if _, err := r.Read(b); err != io.EOF || out.String() != first+second {
+		t.Errorf("at EOF got %v and output %q", err, out.String())
+	}
+}
+
+func TestProgressParallelTTY(t *testing.T) {
+	out, now := fakeProgress(t, true)
+	var readers []io.ReadCloser
+	for _, name := range []string{"a.zip", "b.zip"} {
+		readers = append(readers, newProgressReader(strings.NewReader(strings.Repeat("x", 2000)), name, 0, 2000))
+	}
+
+	b := make([]byte, 1000)
+	*now = now.Add(time.Second)
+	readers[0].Read(b)
+	readers[1].Read(b)
+	if want := "\r\033[K2 transfers: 1.0 kB / 4.0 kB (25%), 1.0 kB/s, ETA 3s"; out.String() != want {
+		t.Errorf("got %q, want one line for both transfers, %q", out.String(), want)
+	}
+
+	out.Reset()
+	*now = now.Add(time.Second)
+	readers[1].Read(b)
+	want := "\r\033[Kb.zip: 2.0 kB / 2.0 kB (100%), 1.0 kB/s\n\r\033[Ka.zip: 1.0 kB / 2.0 kB (50%), 500 B/s, ETA 2s"
+	if out.String() != want {
+		t.Errorf("got %q, want the finished transfer on a line of its own, %q", out.String(), want)
+	}
+	if len(transfers) != 1 || transfers[0] != readers[0] {
+		t.Errorf("unfinished transfers %v, want only a.zip", transfers)
+	}
+
+	// a.zip is abandoned halfway, which clears the line for what comes next.
+	out.Reset()
+	readers[0].Close()
+	readers[1].Close()
+	if out.String() != "\r\033[K" || len(transfers) != 0 {
+		t.Errorf("after closing got %q and unfinished transfers %v", out.String(), transfers)
+	}
+}
+
+func TestProgressRetriedDownload(t *testing.T) {
+	const content = "the contents of the asset, downloaded in two attempts"
+	asset := &Asset{Id: 7, Name: "a.txt", Size: uint64(len(content))}
+
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// Promise everything, then break off halfway.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content[:20]))
+			return
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(content[20:]))
+	}))
+	defer srv.Close()
+	defer func(endpoint string) { EnvApiEndpoint = endpoint }(EnvApiEndpoint)
+	EnvApiEndpoint = srv.URL
+	out, _ := fakeProgress(t, true)
+
+	dest := filepath.Join(t.TempDir(), "a.txt")
+	if err := downloadToFile("o", "r", "v1.0.0", "token", asset, dest, "", RetryPolicy{Attempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("downloaded in %d attempts, want 2", attempts)
+	}
+	if len(transfers) != 0 {
+		t.Errorf("unfinished transfers %v after the download", transfers)
+	}
+	if strings.Contains(out.String(), "transfers") || !strings.HasSuffix(out.String(), "a.txt: 53 B / 53 B (100%)\n") {
+		t.Errorf("got output %q, want a single finished transfer", out.String())
+	}
+}
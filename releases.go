@@ -1,46 +1,29 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
-	"time"
+	"sync"
 
-	"github.com/github-release/github-release/github"
 	"github.com/dustin/go-humanize"
+	"github.com/github-release/github-release/github"
 )
 
 const (
-	RELEASE_LIST_URI    = "/repos/%s/%s/releases"
 	RELEASE_LATEST_URI  = "/repos/%s/%s/releases/latest"
 	RELEASE_DATE_FORMAT = "02/01/2006 at 15:04"
 )
 
-type Release struct {
-	Url         string     `json:"url"`
-	PageUrl     string     `json:"html_url"`
-	UploadUrl   string     `json:"upload_url"`
-	Id          int        `json:"id"`
-	Name        string     `json:"name"`
-	Description string     `json:"body"`
-	TagName     string     `json:"tag_name"`
-	Draft       bool       `json:"draft"`
-	Prerelease  bool       `json:"prerelease"`
-	Created     *time.Time `json:"created_at"`
-	Published   *time.Time `json:"published_at"`
-	Assets      []Asset    `json:"assets"`
-}
-
-func (r *Release) CleanUploadUrl() string {
-	bracket := strings.Index(r.UploadUrl, "{")
-
-	if bracket == -1 {
-		return r.UploadUrl
-	}
-
-	return r.UploadUrl[0:bracket]
-}
+// The API types are defined by the github package.
+type (
+	Release       = github.Release
+	ReleaseCreate = github.ReleaseCreate
+)
 
-func (r *Release) String() string {
+// formatRelease renders r and its assets for the info command.
+func formatRelease(r *Release) string {
 	str := make([]string, len(r.Assets)+1)
 	str[0] = fmt.Sprintf(
 		"%s, name: '%s', description: '%s', id: %d, tagged: %s, published: %s, draft: %v, prerelease: %v",
@@ -58,81 +41,216 @@ func (r *Release) String() string {
 	return strings.Join(str, "\n")
 }
 
-type ReleaseCreate struct {
-	TagName              string `json:"tag_name"`
-	TargetCommitish      string `json:"target_commitish,omitempty"`
-	Name                 string `json:"name"`
-	Body                 string `json:"body"`
-	Draft                bool   `json:"draft"`
-	Prerelease           bool   `json:"prerelease"`
-	GenerateReleaseNotes bool   `json:"generate_release_notes"`
+// CreateRelease creates a new release and returns it as created by Github.
+func CreateRelease(user, repo, token string, params ReleaseCreate) (*Release, error) {
+	// NB: Github appears to ignore the user here - the only thing that seems to
+	// matter is that the token is valid.
+	release, err := newClient(user, token).CreateRelease(user, repo, params)
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity {
+		return nil, fmt.Errorf("%w (this is probably because the release already exists)", err)
+	}
+	return release, err
 }
 
-func Releases(user, repo, authUser, token string) ([]Release, error) {
-	var releases []Release
-	client := github.NewClient(authUser, token, nil)
-	client.SetBaseURL(EnvApiEndpoint)
-	err := client.Get(fmt.Sprintf(RELEASE_LIST_URI, user, repo), &releases)
-	if err != nil {
-		return nil, err
-	}
+// EditRelease updates the release with the given id and returns it as
+// updated by Github.
+func EditRelease(user, repo, token string, id int, params ReleaseCreate) (*Release, error) {
+	return newClient("", token).UpdateRelease(user, repo, id, params)
+}
 
-	return releases, nil
+// Releases returns the releases of the repo, most recent first, at most
+// limit of them unless limit is 0.
+func Releases(user, repo, authUser, token string, limit int) ([]Release, error) {
+	return github.All(newClient(authUser, token).Releases(user, repo, github.PageOptions{Limit: limit}))
 }
 
 func latestReleaseApi(user, repo, authUser, token string) (*Release, error) {
 	var release Release
-	client := github.NewClient(authUser, token, nil)
-	client.SetBaseURL(EnvApiEndpoint)
-	return &release, client.Get(fmt.Sprintf(RELEASE_LATEST_URI, user, repo), &release)
+	return &release, newClient(authUser, token).Get(fmt.Sprintf(RELEASE_LATEST_URI, user, repo), &release)
+}
+
+// LatestPolicy controls which release LatestRelease considers the latest.
+// Drafts are never considered.
+type LatestPolicy struct {
+	// Prereleases allows pre-releases to be picked.
+	Prereleases bool
+	// Semver picks the release whose tag is the highest semantic version
+	// instead of the most recently published one. Tags that aren't
+	// semantic versions are ignored.
+	Semver bool
+	// Constraint, if not nil, restricts the candidates to tags satisfying
+	// it. It implies Semver.
+	Constraint *Constraint
+}
+
+// newLatestPolicy builds a LatestPolicy from command line options.
+func newLatestPolicy(prereleases, semver bool, constraint string) (LatestPolicy, error) {
+	policy := LatestPolicy{Prereleases: prereleases, Semver: semver}
+	if constraint != "" {
+		c, err := ParseConstraint(constraint)
+		if err != nil {
+			return policy, err
+		}
+		policy.Constraint = c
+	}
+	return policy, nil
 }
 
-func LatestRelease(user, repo, authUser, token string) (*Release, error) {
-	// If latestReleaseApi DOESN'T give an error, return the release.
-	if latestRelease, err := latestReleaseApi(user, repo, authUser, token); err == nil {
-		return latestRelease, nil
+func LatestRelease(user, repo, authUser, token string, policy LatestPolicy) (*Release, error) {
+	// The latest release endpoint implements the default policy. If it
+	// DOESN'T give an error, return the release.
+	if policy == (LatestPolicy{}) {
+		if latestRelease, err := latestReleaseApi(user, repo, authUser, token); err == nil {
+			return latestRelease, nil
+		}
 	}
 
 	// The enterprise api doesnt support the latest release endpoint. Get
-	// all releases and compare the published date to get the latest.
-	releases, err := Releases(user, repo, authUser, token)
+	// all releases and pick the latest one ourselves.
+	releases, err := Releases(user, repo, authUser, token, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	var latestRelIndex = -1
-	maxDate := time.Time{}
-	for i, release := range releases {
-		if relDate := *release.Published; relDate.After(maxDate) {
-			maxDate = relDate
-			latestRelIndex = i
-		}
+	latest := selectLatest(releases, policy)
+	if latest == nil && policy.Constraint != nil {
+		return nil, fmt.Errorf("no release matches %s", policy.Constraint)
 	}
-	if latestRelIndex == -1 {
+	if latest == nil {
 		return nil, fmt.Errorf("could not find the latest release")
 	}
 
-	vprintln("Scanning ", len(releases), "releases, latest release is", releases[latestRelIndex])
-	return &releases[latestRelIndex], nil
+	vprintln("Scanning ", len(releases), "releases, latest release is", latest.TagName)
+	return latest, nil
+}
+
+// selectLatest returns the latest of releases according to policy, or nil
+// if none qualifies.
+func selectLatest(releases []Release, policy LatestPolicy) *Release {
+	// A constraint that explicitly mentions a pre-release asks for them.
+	prereleases := policy.Prereleases || (policy.Constraint != nil && policy.Constraint.pre)
+
+	var latest *Release
+	var latestVersion *Version
+	for i := range releases {
+		release := &releases[i]
+		if release.Draft || (release.Prerelease && !prereleases) {
+			continue
+		}
+
+		if policy.Semver || policy.Constraint != nil {
+			v, err := ParseVersion(release.TagName)
+			if err != nil {
+				vprintf("ignoring release %s: %v\n", release.TagName, err)
+				continue
+			}
+			if v.Pre != nil && !prereleases {
+				continue
+			}
+			if policy.Constraint != nil && !policy.Constraint.check(v, prereleases) {
+				continue
+			}
+			if latest == nil || v.Compare(latestVersion) > 0 {
+				latest, latestVersion = release, v
+			}
+			continue
+		}
+
+		if release.Published == nil {
+			continue
+		}
+		if latest == nil || release.Published.After(*latest.Published) {
+			latest = release
+		}
+	}
+	return latest
 }
 
+// ReleaseOfTag returns the release of tag, which may be a draft. Once
+// found, the id of the release is remembered for the rest of the run.
 func ReleaseOfTag(user, repo, tag, authUser, token string) (*Release, error) {
-	releases, err := Releases(user, repo, authUser, token)
+	client := newClient(authUser, token)
+	if id, ok := knownReleaseId(user, repo, tag); ok {
+		release, err := client.Release(user, repo, id)
+		if err == nil && release.TagName == tag {
+			return release, nil
+		}
+		vprintf("release %d no longer belongs to tag %s, looking it up again\n", id, tag)
+		forgetReleaseId(user, repo, tag)
+	}
+
+	release, err := client.ReleaseByTag(user, repo, tag)
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		vprintf("no published release for tag %s, looking for a draft\n", tag)
+		release, err = draftOfTag(client, user, repo, tag)
+	}
 	if err != nil {
 		return nil, err
 	}
+	rememberReleaseId(user, repo, tag, release.Id)
+	return release, nil
+}
 
-	for _, release := range releases {
+// draftOfTag looks for the release of tag among all releases, which
+// includes drafts.
+func draftOfTag(client github.Client, user, repo, tag string) (*Release, error) {
+	for release, err := range client.Releases(user, repo, github.PageOptions{}) {
+		if err != nil {
+			return nil, err
+		}
 		if release.TagName == tag {
 			return &release, nil
 		}
 	}
+	return nil, releaseNotFoundError{tag}
+}
 
-	return nil, fmt.Errorf("could not find the release corresponding to tag %s", tag)
+// The ids of the releases looked up by tag so far.
+var releaseIds = struct {
+	sync.Mutex
+	m map[string]int
+}{m: make(map[string]int)}
+
+func releaseKey(user, repo, tag string) string {
+	return user + "/" + repo + "@" + tag
+}
+
+func knownReleaseId(user, repo, tag string) (int, bool) {
+	releaseIds.Lock()
+	defer releaseIds.Unlock()
+	id, ok := releaseIds.m[releaseKey(user, repo, tag)]
+	return id, ok
+}
+
+func rememberReleaseId(user, repo, tag string, id int) {
+	releaseIds.Lock()
+	defer releaseIds.Unlock()
+	releaseIds.m[releaseKey(user, repo, tag)] = id
+}
+
+func forgetReleaseId(user, repo, tag string) {
+	releaseIds.Lock()
+	defer releaseIds.Unlock()
+	delete(releaseIds.m, releaseKey(user, repo, tag))
+}
+
+// releaseNotFoundError is returned by ReleaseOfTag if there is no release
+// for the tag.
+type releaseNotFoundError struct {
+	tag string
+}
+
+func (e releaseNotFoundError) Error() string {
+	return fmt.Sprintf("could not find the release corresponding to tag %s", e.tag)
 }
 
 /* find the release-id of the specified tag */
 func IdOfTag(user, repo, tag, authUser, token string) (int, error) {
+	if id, ok := knownReleaseId(user, repo, tag); ok {
+		return id, nil
+	}
 	release, err := ReleaseOfTag(user, repo, tag, authUser, token)
 	if err != nil {
 		return 0, err
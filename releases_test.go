@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReleaseOfTag(t *testing.T) {
+	releases := []Release{
+		{Id: 1, TagName: "v1.0.0"},
+		{Id: 2, TagName: "v2.0.0-rc1", Draft: true},
+	}
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/o/r/releases/tags/v1.0.0":
+			json.NewEncoder(w).Encode(releases[0])
+		case "/repos/o/r/releases/1":
+			json.NewEncoder(w).Encode(releases[0])
+		case "/repos/o/r/releases":
+			json.NewEncoder(w).Encode(releases)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer srv.Close()
+	defer func(endpoint string) { EnvApiEndpoint = endpoint }(EnvApiEndpoint)
+	EnvApiEndpoint = srv.URL
+	for _, tag := range []string{"v1.0.0", "v2.0.0-rc1"} {
+		forgetReleaseId("o", "r", tag)
+	}
+
+	tests := []struct {
+		tag      string
+		id       int
+		requests []string
+	}{
+		{"v1.0.0", 1, []string{"/repos/o/r/releases/tags/v1.0.0"}},
+		// The id is known now.
+		{"v1.0.0", 1, []string{"/repos/o/r/releases/1"}},
+		// Drafts aren't found by tag.
+		{"v2.0.0-rc1", 2, []string{"/repos/o/r/releases/tags/v2.0.0-rc1", "/repos/o/r/releases"}},
+		{"v3.0.0", 0, []string{"/repos/o/r/releases/tags/v3.0.0", "/repos/o/r/releases"}},
+	}
+	for _, tt := range tests {
+		requests = nil
+		rel, err := ReleaseOfTag("o", "r", tt.tag, "", "token")
+		switch {
+		case tt.id == 0:
+			if _, ok := err.(releaseNotFoundError); !ok {
+				t.Errorf("%s: want releaseNotFoundError, got %v", tt.tag, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.tag, err)
+		case rel.Id != tt.id:
+			t.Errorf("%s: got release %d, want %d", tt.tag, rel.Id, tt.id)
+		}
+		if len(requests) != len(tt.requests) {
+			t.Errorf("%s: requested %q, want %q", tt.tag, requests, tt.requests)
+			continue
+		}
+		for i := range requests {
+			if requests[i] != tt.requests[i] {
+				t.Errorf("%s: requested %q, want %q", tt.tag, requests, tt.requests)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/github-release/github-release/github"
+)
+
+// RetryPolicy describes how often and how patiently a failed operation is
+// retried.
+type RetryPolicy struct {
+	Attempts  int           // Total number of attempts, including the first.
+	BaseDelay time.Duration // Delay before the first retry.
+	MaxDelay  time.Duration // Upper bound for any single delay.
+}
+
+// DefaultRetryPolicy is used when the user doesn't ask for anything else.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 1 * time.Second,
+	MaxDelay:  30 * time.Second,
+}
+
+// Delay returns how long to wait before the given attempt (1-based; attempt
+// 1 is the first retry). The delay grows exponentially and is jittered
+// ("equal jitter": a random duration between half of it and all of it) so
+// that parallel uploaders don't retry in lockstep. A MaxDelay of 0 doesn't
+// limit it, one below BaseDelay is raised to it: the delay is never capped
+// below what was asked for.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay > 0 && maxDelay < p.BaseDelay {
+		maxDelay = p.BaseDelay
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < math.MaxInt64/2 && (maxDelay == 0 || d < maxDelay); i++ {
+		d *= 2
+	}
+	if maxDelay > 0 && d > maxDelay {
+		d = maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryableError marks an error as transient, i.e. trying again may help.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string { return e.err.Error() }
+func (e retryableError) Unwrap() error { return e.err }
+
+// retry calls fn until it succeeds, returns an error that is not marked
+// retryable, or the policy runs out of attempts. what describes the
+// operation in verbose output.
+func (p RetryPolicy) retry(what string, fn func(attempt int) error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			d := p.Delay(attempt - 1)
+			vprintf("%s: attempt %d/%d failed (%v), retrying in %v\n", what, attempt-1, attempts, err, d.Round(time.Millisecond))
+			time.Sleep(d)
+		}
+		vprintf("%s: attempt %d/%d\n", what, attempt, attempts)
+		err = fn(attempt)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(retryableError); !ok {
+			return err
+		}
+	}
+	return err.(retryableError).err
+}
+
+// isTransient reports whether err may go away by trying again: network
+// errors and server side errors.
+func isTransient(err error) bool {
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/github-release/github-release/github"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	longest := time.Second
+	for longest < math.MaxInt64/2 {
+		longest *= 2
+	}
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration // The delay before jitter.
+	}{
+		{"first retry", DefaultRetryPolicy, 1, 1 * time.Second},
+		{"doubles", DefaultRetryPolicy, 3, 4 * time.Second},
+		{"capped", DefaultRetryPolicy, 10, 30 * time.Second},
+		{"base above max", RetryPolicy{BaseDelay: time.Minute, MaxDelay: 30 * time.Second}, 1, time.Minute},
+		{"base above max doesn't grow", RetryPolicy{BaseDelay: time.Minute, MaxDelay: 30 * time.Second}, 3, time.Minute},
+		{"no max", RetryPolicy{BaseDelay: time.Second}, 4, 8 * time.Second},
+		{"no max doesn't overflow", RetryPolicy{BaseDelay: time.Second}, 100, longest},
+		{"no delay", RetryPolicy{MaxDelay: time.Second}, 3, 0},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := tt.policy.Delay(tt.attempt); got < tt.want/2 || got > tt.want {
+				t.Errorf("%s: Delay(%d) = %v, want between %v and %v", tt.name, tt.attempt, got, tt.want/2, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+	policy := RetryPolicy{Attempts: 3}
+
+	tests := []struct {
+		name      string
+		errs      []error // Returned by the successive attempts, nil once they run out.
+		wantErr   error
+		wantCalls int
+	}{
+		{"success", nil, nil, 1},
+		{"success after retries", []error{retryableError{errTransient}, retryableError{errTransient}}, nil, 3},
+		{"not retryable", []error{retryableError{errTransient}, errFatal}, errFatal, 2},
+		{"out of attempts", []error{retryableError{errTransient}, retryableError{errTransient}, retryableError{errTransient}, nil}, errTransient, 3},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := policy.retry(tt.name, func(attempt int) error {
+			calls++
+			if attempt != calls {
+				t.Errorf("%s: attempt %d on call %d", tt.name, attempt, calls)
+			}
+			if attempt > len(tt.errs) {
+				return nil
+			}
+			return tt.errs[attempt-1]
+		})
+		if err != tt.wantErr {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.wantCalls)
+		}
+	}
+
+	calls := 0
+	RetryPolicy{}.retry("no attempts", func(int) error {
+		calls++
+		return retryableError{errTransient}
+	})
+	if calls != 1 {
+		t.Errorf("a policy without attempts made %d calls, want 1", calls)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"server error", &github.APIError{StatusCode: 502}, true},
+		{"client error", &github.APIError{StatusCode: 422}, false},
+		{"not found", &github.APIError{StatusCode: 404}, false},
+		{"network error", &url.Error{Op: "Get", URL: "https://api.github.com", Err: errors.New("connection reset")}, true},
+		{"wrapped", fmt.Errorf("could not upload, %w", &github.APIError{StatusCode: 503}), true},
+		{"other", errors.New("invalid pattern"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("%s: isTransient(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version (https://semver.org) as found in release
+// tags. A leading "v" and missing minor or patch numbers are tolerated, so
+// "v1.2" parses as 1.2.0.
+type Version struct {
+	Major, Minor, Patch uint64
+	Pre                 []string // Pre-release identifiers, e.g. ["rc", "1"].
+	Build               string   // Build metadata, ignored for precedence.
+}
+
+// ParseVersion parses a semantic version, see Version.
+func ParseVersion(s string) (*Version, error) {
+	orig := s
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+
+	var v Version
+	if i := strings.IndexByte(s, '+'); i != -1 {
+		v.Build = s[i+1:]
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		v.Pre = strings.Split(s[i+1:], ".")
+		for _, id := range v.Pre {
+			if id == "" {
+				return nil, fmt.Errorf("invalid version %q: empty pre-release identifier", orig)
+			}
+		}
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid version %q", orig)
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", orig)
+		}
+		*nums[i] = n
+	}
+	return &v, nil
+}
+
+// Compare returns -1, 0 or 1 if v has lower, equal or higher precedence
+// than o.
+func (v *Version) Compare(o *Version) int {
+	for _, c := range [][2]uint64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if c[0] != c[1] {
+			if c[0] < c[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A version without pre-release identifiers has higher precedence.
+	switch {
+	case len(v.Pre) == 0 && len(o.Pre) == 0:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Pre) && i < len(o.Pre); i++ {
+		if c := comparePreID(v.Pre[i], o.Pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Pre) < len(o.Pre):
+		return -1
+	case len(v.Pre) > len(o.Pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePreID compares two pre-release identifiers: numeric ones
+// numerically and lower than alphanumeric ones, which compare in ASCII
+// order.
+func comparePreID(a, b string) int {
+	an, aerr := strconv.ParseUint(a, 10, 64)
+	bn, berr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aerr == nil && berr == nil:
+		if an == bn {
+			return 0
+		}
+		if an < bn {
+			return -1
+		}
+		return 1
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + strings.Join(v.Pre, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Constraint is a set of version ranges a version can be matched against,
+// e.g. ">=2.0.0 <3", "~1.4", "^1.2.3", "1.4.x" or "1.x || >=3". Comparators
+// separated by spaces or commas must all match; ranges separated by "||"
+// are alternatives.
+//
+// Pre-release versions only match if one of the comparators mentions a
+// pre-release itself, otherwise "<2.0.0" would match "2.0.0-rc.1".
+type Constraint struct {
+	ranges [][]comparator
+	pre    bool // Some comparator mentions a pre-release.
+	str    string
+}
+
+type comparator func(*Version) bool
+
+// ParseConstraint parses a version constraint, see Constraint.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{str: s}
+	for _, alt := range strings.Split(s, "||") {
+		var cmps []comparator
+		for _, field := range strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' }) {
+			cmp, pre, err := parseComparator(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %v", s, err)
+			}
+			c.pre = c.pre || pre
+			cmps = append(cmps, cmp)
+		}
+		if len(cmps) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: empty range", s)
+		}
+		c.ranges = append(c.ranges, cmps)
+	}
+	return c, nil
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *Constraint) Check(v *Version) bool {
+	return c.check(v, c.pre)
+}
+
+// check is like Check, but lets the caller decide whether pre-releases may
+// match.
+func (c *Constraint) check(v *Version, pre bool) bool {
+	if len(v.Pre) > 0 && !pre {
+		return false
+	}
+	for _, cmps := range c.ranges {
+		ok := true
+		for _, cmp := range cmps {
+			ok = ok && cmp(v)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Constraint) String() string { return c.str }
+
+// parseComparator parses a single comparator like ">=1.2", "~1.4" or
+// "1.x". Partial versions stand for the range of versions they cover, so
+// "<=1.4" means "<1.5.0" and "1.4" means ">=1.4.0 <1.5.0". It also reports
+// whether the version mentions a pre-release.
+func parseComparator(s string) (comparator, bool, error) {
+	op := s[:len(s)-len(strings.TrimLeft(s, "<>=!~^"))]
+	lo, parts, err := parsePartialVersion(s[len(op):])
+	if err != nil {
+		return nil, false, err
+	}
+	pre := len(lo.Pre) > 0
+
+	// hi is the first version past the range covered by a partial version.
+	hi := &Version{Major: lo.Major + 1}
+	switch parts {
+	case 0:
+		if op == "" || op == "=" || op == ">=" || op == "<=" {
+			return func(*Version) bool { return true }, pre, nil
+		}
+		return nil, false, fmt.Errorf("wildcard cannot be used with %q", op)
+	case 2:
+		hi = &Version{Major: lo.Major, Minor: lo.Minor + 1}
+	case 3:
+		hi = nil // Not a range, compare exactly.
+	}
+
+	ge := func(b *Version) comparator { return func(v *Version) bool { return v.Compare(b) >= 0 } }
+	lt := func(b *Version) comparator { return func(v *Version) bool { return v.Compare(b) < 0 } }
+	between := func(a, b *Version) comparator { return func(v *Version) bool { return ge(a)(v) && lt(b)(v) } }
+
+	switch op {
+	case "", "=", "==":
+		if hi == nil {
+			return func(v *Version) bool { return v.Compare(lo) == 0 }, pre, nil
+		}
+		return between(lo, hi), pre, nil
+	case "!=":
+		if hi == nil {
+			return func(v *Version) bool { return v.Compare(lo) != 0 }, pre, nil
+		}
+		return func(v *Version) bool { return !between(lo, hi)(v) }, pre, nil
+	case ">":
+		if hi == nil {
+			return func(v *Version) bool { return v.Compare(lo) > 0 }, pre, nil
+		}
+		return ge(hi), pre, nil
+	case ">=":
+		return ge(lo), pre, nil
+	case "<":
+		return lt(lo), pre, nil
+	case "<=":
+		if hi == nil {
+			return func(v *Version) bool { return v.Compare(lo) <= 0 }, pre, nil
+		}
+		return lt(hi), pre, nil
+	case "~":
+		// Patch updates if the minor version is given, minor ones otherwise.
+		if parts == 1 {
+			return between(lo, &Version{Major: lo.Major + 1}), pre, nil
+		}
+		return between(lo, &Version{Major: lo.Major, Minor: lo.Minor + 1}), pre, nil
+	case "^":
+		// Updates that don't change the left-most non-zero number.
+		switch {
+		case lo.Major > 0 || parts == 1:
+			return between(lo, &Version{Major: lo.Major + 1}), pre, nil
+		case lo.Minor > 0 || parts == 2:
+			return between(lo, &Version{Minor: lo.Minor + 1}), pre, nil
+		}
+		return between(lo, &Version{Patch: lo.Patch + 1}), pre, nil
+	}
+	return nil, false, fmt.Errorf("unknown operator %q", op)
+}
+
+// parsePartialVersion parses a version that may be cut short or end in a
+// wildcard (x, X or *), returning how many numbers were given.
+func parsePartialVersion(s string) (*Version, int, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	core, suffix := trimmed, ""
+	if i := strings.IndexAny(trimmed, "-+"); i != -1 {
+		core, suffix = trimmed[:i], trimmed[i:]
+	}
+
+	numbers := strings.Split(core, ".")
+	parts := 0
+	for _, n := range numbers {
+		if n == "x" || n == "X" || n == "*" {
+			break
+		}
+		parts++
+	}
+	if parts < len(numbers) && suffix != "" {
+		return nil, 0, fmt.Errorf("invalid version %q: wildcard with pre-release", s)
+	}
+	if parts == 0 {
+		return &Version{}, 0, nil
+	}
+
+	// Drop the wildcards and let ParseVersion do the rest.
+	v, err := ParseVersion(strings.Join(numbers[:parts], ".") + suffix)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, parts, nil
+}
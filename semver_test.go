@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{"1.2.3", "1.2.3"},
+		{"v1.2.3", "1.2.3"},
+		{"v1.2", "1.2.0"},
+		{"1", "1.0.0"},
+		{"v2.0.0-rc.1", "2.0.0-rc.1"},
+		{"1.0.0-alpha+build.5", "1.0.0-alpha+build.5"},
+	} {
+		v, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.in, err)
+			continue
+		}
+		if got := v.String(); got != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "v", "latest", "1.2.3.4", "1.x", "1.0.0-", "1.0.0-a..b"} {
+		if _, err := ParseVersion(in); err == nil {
+			t.Errorf("ParseVersion(%q) should fail", in)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// In increasing order of precedence, from the semver spec.
+	versions := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := range versions {
+		for j := range versions {
+			a, _ := ParseVersion(versions[i])
+			b, _ := ParseVersion(versions[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s compared to %s = %d, want %d", versions[i], versions[j], got, want)
+			}
+		}
+	}
+
+	a, _ := ParseVersion("1.0.0+linux")
+	b, _ := ParseVersion("v1.0.0+darwin")
+	if a.Compare(b) != 0 {
+		t.Error("build metadata should not affect precedence")
+	}
+}
+
+func TestSelectLatest(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	releases := []Release{
+		{TagName: "v3.0.0", Draft: true},
+		{TagName: "v1.10.0", Published: day(1)},
+		{TagName: "v2.0.0-rc.1", Prerelease: true, Published: day(5)},
+		{TagName: "v1.9.0", Published: day(3)},
+		{TagName: "nightly", Published: day(4)},
+	}
+	for _, tt := range []struct {
+		policy LatestPolicy
+		want   string
+	}{
+		{LatestPolicy{}, "nightly"},
+		{LatestPolicy{Prereleases: true}, "v2.0.0-rc.1"},
+		{LatestPolicy{Semver: true}, "v1.10.0"},
+		{LatestPolicy{Semver: true, Prereleases: true}, "v2.0.0-rc.1"},
+	} {
+		got := selectLatest(releases, tt.policy)
+		if got == nil || got.TagName != tt.want {
+			t.Errorf("selectLatest(%+v) = %v, want %s", tt.policy, got, tt.want)
+		}
+	}
+
+	if got := selectLatest(releases[:1], LatestPolicy{}); got != nil {
+		t.Errorf("drafts should never be the latest release, got %s", got.TagName)
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	for _, tt := range []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"1.4.x", []string{"1.4.0", "v1.4.10"}, []string{"1.5.0", "1.3.9", "1.4.1-rc.1"}},
+		{"1.4", []string{"1.4.0", "1.4.99"}, []string{"1.5.0"}},
+		{"~1.4", []string{"1.4.0", "1.4.3"}, []string{"1.5.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{">=2.0.0 <3", []string{"2.0.0", "2.99.0"}, []string{"1.9.9", "3.0.0", "3.0.0-rc.1"}},
+		{">=2.0.0, <3", []string{"2.5.0"}, []string{"3.0.0"}},
+		{">1.4", []string{"1.5.0"}, []string{"1.4.9"}},
+		{"<=1.4", []string{"1.4.9"}, []string{"1.5.0"}},
+		{"!=1.4.2", []string{"1.4.1", "1.4.3"}, []string{"1.4.2"}},
+		{"1.x || >=3", []string{"1.2.0", "3.1.0"}, []string{"2.0.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-beta"}},
+		{">=2.0.0-rc.1", []string{"2.0.0-rc.2", "2.0.0"}, []string{"2.0.0-beta"}},
+	} {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		for _, s := range tt.match {
+			if v, _ := ParseVersion(s); !c.Check(v) {
+				t.Errorf("%s should satisfy %q", s, tt.constraint)
+			}
+		}
+		for _, s := range tt.noMatch {
+			if v, _ := ParseVersion(s); c.Check(v) {
+				t.Errorf("%s should not satisfy %q", s, tt.constraint)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "||", ">>1", "~*", "1.x-rc", "=>1.0"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) should fail", s)
+		}
+	}
+}
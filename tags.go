@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"iter"
 
 	"github.com/github-release/github-release/github"
 )
@@ -21,10 +22,7 @@ func (t *Tag) String() string {
 	return t.Name + " (commit: " + t.Commit.Url + ")"
 }
 
-// Get the tags associated with a repo.
-func Tags(user, repo, authUser, token string) ([]Tag, error) {
-	var tags []Tag
-	client := github.NewClient(authUser, token, nil)
-	client.SetBaseURL(EnvApiEndpoint)
-	return tags, client.Get(fmt.Sprintf(TAGS_URI, user, repo), &tags)
+// Tags iterates over the tags of the repo.
+func Tags(user, repo, authUser, token string, opts github.PageOptions) iter.Seq2[Tag, error] {
+	return github.Paginate[Tag](newClient(authUser, token), fmt.Sprintf(TAGS_URI, user, repo), opts)
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/github-release/github-release/github"
+)
+
+// readTokenFile returns the token stored in the file at path.
+func readTokenFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read token: %v", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// runTokenCommand runs command with the shell and returns what it prints.
+func runTokenCommand(command, dir string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("token command %q failed: %v", command, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// tokenSource obtains a token, or returns "" if it isn't configured.
+type tokenSource func() (string, error)
+
+// firstToken returns the token of the first of sources that has one. The
+// sources after it aren't consulted.
+func firstToken(sources ...tokenSource) (string, error) {
+	for _, source := range sources {
+		if token, err := source(); token != "" || err != nil {
+			return token, err
+		}
+	}
+	return "", nil
+}
+
+// resolveToken returns the token from, in order of decreasing priority,
+// the global options, the profile if it was named, the environment and the
+// profile otherwise. Only the source that wins is consulted, so that e.g. a
+// Github App installation token isn't requested in vain. The
+// --security-token option of the command still wins over all of these,
+// see securityToken.
+func resolveToken(options Options, profile *Profile, named bool) (string, error) {
+	if named {
+		return firstToken(optionsToken(options), profile.resolveToken, envToken)
+	}
+	return firstToken(optionsToken(options), envToken, profile.resolveToken)
+}
+
+// optionsToken is the token given by the global options, which take
+// precedence over the environment and config files.
+func optionsToken(options Options) tokenSource {
+	return func() (string, error) {
+		switch {
+		case options.AppID != 0:
+			return appToken(options.AppID, options.AppInstallationID, options.AppKey)
+		case options.TokenFile != "":
+			return readTokenFile(options.TokenFile)
+		case options.TokenCommand != "":
+			return runTokenCommand(options.TokenCommand, "")
+		}
+		return "", nil
+	}
+}
+
+// envToken is the token given by the environment: a Github App, $GITHUB_TOKEN
+// or $GITHUB_TOKEN_FILE.
+func envToken() (string, error) {
+	switch {
+	case EnvAppID != "":
+		return envAppToken()
+	case EnvToken != "":
+		return EnvToken, nil
+	case EnvTokenFile != "":
+		return readTokenFile(EnvTokenFile)
+	}
+	return "", nil
+}
+
+// appToken sets up authentication as an installation of the Github App id,
+// using the private key in the PEM file keyFile, and returns the first
+// installation token. The token is replaced by a fresh one before it
+// expires, see github.DefaultApp.
+func appToken(id, installation int64, keyFile string) (string, error) {
+	if installation == 0 || keyFile == "" {
+		return "", fmt.Errorf("Github App authentication needs an installation id and a private key")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read private key: %v", err)
+	}
+	key, err := github.ParsePrivateKey(data)
+	if err != nil {
+		return "", err
+	}
+	app := &github.App{
+		ID:             id,
+		InstallationID: installation,
+		Key:            key,
+		BaseURL:        EnvApiEndpoint,
+	}
+	token, err := app.Token()
+	if err != nil {
+		return "", err
+	}
+	github.DefaultApp = app
+	return token, nil
+}
+
+// envAppToken is appToken configured by the GITHUB_APP_* environment
+// variables.
+func envAppToken() (string, error) {
+	id, err := strconv.ParseInt(EnvAppID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid GITHUB_APP_ID %q", EnvAppID)
+	}
+	installation, err := strconv.ParseInt(nvls(EnvAppInstallationID, "0"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID %q", EnvAppInstallationID)
+	}
+	return appToken(id, installation, EnvAppKeyFile)
+}
+
+// Set to ask git's credential helpers for a token if there is none,
+// see securityToken.
+var useGitCredential = false
+
+// securityToken returns the token to authenticate with, given the value of
+// the --security-token option of a command. If there is no token from any
+// other source and useGitCredential is set, git's credential helpers are
+// asked for one. That is opt-in, because it would send whatever password
+// git stores for the host to the API, even for anonymous downloads.
+func securityToken(flag string) string {
+	if token := nvls(flag, EnvToken); token != "" || !useGitCredential {
+		return token
+	}
+	token, err := gitCredentialToken(nvls(EnvApiEndpoint, github.DefaultBaseURL))
+	if err != nil {
+		vprintln("no token from git credential helpers:", err)
+		return ""
+	}
+	vprintln("using the token of the git credential helpers")
+	EnvToken = token // Don't ask twice.
+	return token
+}
+
+// gitCredentialToken asks the git credential helpers for the password
+// (i.e. token) of the Github host the API at apiURL belongs to, the way git
+// would for cloning over HTTPS. git itself is never allowed to prompt.
+func gitCredentialToken(apiURL string) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", err
+	}
+	host := u.Host
+	if host == "api.github.com" {
+		host = "github.com"
+	}
+
+	cmd := exec.Command("git", "-c", "credential.interactive=false", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", u.Scheme, host))
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git credential fill: %v", err)
+	}
+	cred, err := parseCredential(out)
+	if err != nil {
+		return "", err
+	}
+	if cred["password"] == "" {
+		return "", fmt.Errorf("no password for %s", host)
+	}
+	return cred["password"], nil
+}
+
+// parseCredential parses the key=value lines of the git credential
+// protocol, see git-credential(1).
+func parseCredential(b []byte) (map[string]string, error) {
+	cred := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed git credential output")
+		}
+		cred[key] = value
+	}
+	return cred, scanner.Err()
+}
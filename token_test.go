@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseCredential(t *testing.T) {
+	cred, err := parseCredential([]byte("protocol=https\nhost=github.com\nusername=aktau\npassword=gh=p_s3cr3t\n\nignored=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred["username"] != "aktau" || cred["password"] != "gh=p_s3cr3t" || cred["ignored"] != "" {
+		t.Errorf("parseCredential = %v", cred)
+	}
+
+	if _, err := parseCredential([]byte("password\n")); err == nil {
+		t.Error("lines without = should be an error")
+	}
+}
+
+func TestFirstToken(t *testing.T) {
+	var consulted []string
+	source := func(name, token string) tokenSource {
+		return func() (string, error) {
+			consulted = append(consulted, name)
+			return token, nil
+		}
+	}
+	token, err := firstToken(source("flags", ""), source("env", "t0k3n"), source("app", "never"))
+	if err != nil || token != "t0k3n" {
+		t.Errorf("firstToken() = %q, %v", token, err)
+	}
+	if len(consulted) != 2 {
+		t.Errorf("consulted %q, want the sources up to the first token only", consulted)
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := func(token string) string {
+		path := filepath.Join(dir, token)
+		if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	defer func(token, file, app string) { EnvToken, EnvTokenFile, EnvAppID = token, file, app }(EnvToken, EnvTokenFile, EnvAppID)
+	EnvAppID = ""
+
+	tests := []struct {
+		name    string
+		options Options
+		env     string // $GITHUB_TOKEN
+		envFile string // $GITHUB_TOKEN_FILE
+		profile Profile
+		named   bool
+		flag    string // --security-token
+		want    string
+	}{
+		{name: "env", env: "env", envFile: tokenFile("env-file"), want: "env"},
+		{name: "env file", envFile: tokenFile("env-file"), want: "env-file"},
+		{name: "token file", options: Options{TokenFile: tokenFile("file")}, env: "env", want: "file"},
+		{name: "token command", options: Options{TokenCommand: "echo command"}, env: "env", want: "command"},
+		{name: "file over command", options: Options{TokenFile: tokenFile("file"), TokenCommand: "echo command"}, want: "file"},
+		{name: "security token", options: Options{TokenFile: tokenFile("file")}, env: "env", flag: "flag", want: "flag"},
+		{name: "default profile", profile: Profile{TokenCommand: "echo profile"}, env: "env", want: "env"},
+		{name: "default profile only", profile: Profile{TokenCommand: "echo profile"}, want: "profile"},
+		{name: "named profile", profile: Profile{TokenCommand: "echo profile"}, named: true, env: "env", want: "profile"},
+		{name: "options over named profile", options: Options{TokenCommand: "echo command"}, profile: Profile{Token: "profile"}, named: true, want: "command"},
+	}
+	for _, tt := range tests {
+		EnvToken, EnvTokenFile = tt.env, tt.envFile
+		token, err := resolveToken(tt.options, &tt.profile, tt.named)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		EnvToken = token
+		if got := securityToken(tt.flag); got != tt.want {
+			t.Errorf("%s: got token %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSecurityTokenGitCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script standing in for git")
+	}
+	// A git that records being asked, and knows a password.
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "asked")
+	script := "#!/bin/sh\n: > " + marker + "\nprintf 'password=from-git\\n'\n"
+	if err := os.WriteFile(filepath.Join(dir, "git"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	defer func(token string, use bool) { EnvToken, useGitCredential = token, use }(EnvToken, useGitCredential)
+	EnvToken = ""
+
+	useGitCredential = false
+	if got := securityToken(""); got != "" {
+		t.Errorf("got token %q without --git-credential", got)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("git was asked without --git-credential")
+	}
+
+	useGitCredential = true
+	if got := securityToken(""); got != "from-git" {
+		t.Errorf("got token %q, want the one of git", got)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("git was not asked with --git-credential")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/github-release/github-release/github"
+)
+
+// uploadFile is a single file scheduled for upload by the upload command.
+type uploadFile struct {
+	Path string // Path on disk, "-" for stdin.
+	Name string // Asset name on GitHub.
+
+	Asset *Asset // The uploaded asset, set on success.
+	Err   error  // Set on failure.
+}
+
+// expandUploadFiles turns the file arguments of the upload command into a
+// list of files to upload. Arguments may be plain paths, glob patterns
+// (expanded with filepath.Glob) or "-" for stdin. Asset names default to
+// the basename of each file; name overrides it but is only allowed when
+// exactly one file is uploaded.
+func expandUploadFiles(patterns []string, name string) ([]*uploadFile, error) {
+	var files []*uploadFile
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		paths := []string{pattern}
+		if pattern != "-" && strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("pattern %q did not match any files", pattern)
+			}
+			paths = matches
+		}
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			files = append(files, &uploadFile{Path: path, Name: filepath.Base(path)})
+		}
+	}
+
+	switch {
+	case len(files) == 0:
+		return nil, fmt.Errorf("no files to upload")
+	case name != "" && len(files) > 1:
+		return nil, fmt.Errorf("--name can only be used when uploading a single file, got %d files", len(files))
+	case name != "":
+		files[0].Name = name
+	}
+
+	names := make(map[string]string)
+	for _, f := range files {
+		if f.Path == "-" && name == "" {
+			return nil, fmt.Errorf("uploading from stdin requires --name")
+		}
+		if other, ok := names[f.Name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be uploaded as %s", other, f.Path, f.Name)
+		}
+		names[f.Name] = f.Path
+	}
+	return files, nil
+}
+
+// uploadFiles uploads files to rel using at most parallel concurrent
+// uploads. assets is the list of assets currently attached to rel. The
+// outcome of each upload is recorded in the uploadFile itself; the
+// returned error only summarizes how many uploads failed.
+func uploadFiles(user, repo, authUser, token string, rel *Release, assets []Asset, files []*uploadFile, label string, replace bool, parallel int, policy RetryPolicy) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	jobs := make(chan *uploadFile)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				f.Asset, f.Err = uploadPath(user, repo, authUser, token, rel, assets, f, label, replace, policy)
+			}
+		}()
+	}
+	for _, f := range files {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, f := range files {
+		if f.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, len(files))
+	}
+	return nil
+}
+
+// uploadPath opens a single file and uploads it, first removing a
+// conflicting asset if that is allowed.
+func uploadPath(user, repo, authUser, token string, rel *Release, assets []Asset, f *uploadFile, label string, replace bool, policy RetryPolicy) (*Asset, error) {
+	file := os.Stdin
+	if f.Path != "-" {
+		var err error
+		if file, err = os.Open(f.Path); err != nil {
+			return nil, err
+		}
+		defer file.Close()
+	}
+
+	// Streams can't be rewound to retry a failed upload, and their size
+	// isn't known up front. Spool them to disk first.
+	stream, err := github.IsStream(file)
+	if err != nil {
+		return nil, err
+	}
+	if stream {
+		vprintf("%s is a stream, spooling to disk\n", f.Path)
+		spooled, _, err := github.SpoolFile(file)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(spooled.Name())
+		defer spooled.Close()
+		file = spooled
+	}
+
+	// Incomplete (failed) uploads will have their state set to new. These
+	// assets are (AFAIK) useless in all cases. The only thing they will do
+	// is prevent the upload of another asset of the same name. To work
+	// around this GH API weirdness, let's just delete them.
+	//
+	// Complete assets are only touched if the user explicitly asked to
+	// replace them with -R, in which case the swap is done safely.
+	if asset := findAsset(assets, f.Name); asset != nil {
+		if asset.State != "new" && replace {
+			return replaceAsset(user, repo, authUser, token, rel, asset, label, file, policy)
+		}
+		if asset.State == "new" {
+			vprintf("asset (id: %d) already existed in state %s: removing...\n", asset.Id, asset.State)
+			if err := deleteAsset(user, repo, token, asset); err != nil {
+				return nil, fmt.Errorf("could not remove incomplete asset: %w", err)
+			}
+		}
+	}
+
+	return uploadAsset(user, repo, authUser, token, rel, f.Name, label, file, policy)
+}
+
+// replaceAsset replaces old with the contents of file without ever leaving
+// the release without an asset of that name if something goes wrong. The
+// file is first uploaded under a temporary name, then old is deleted and
+// the new asset is renamed to take its place. Unless a label is given, the
+// label of old is kept.
+func replaceAsset(user, repo, authUser, token string, rel *Release, old *Asset, label string, file *os.File, policy RetryPolicy) (*Asset, error) {
+	label = nvls(label, old.Label)
+	tmpName, err := temporaryAssetName(old.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	vprintf("replacing asset %s (id: %d): uploading as %s first\n", old.Name, old.Id, tmpName)
+	asset, err := uploadAsset(user, repo, authUser, token, rel, tmpName, label, file, policy)
+	if err != nil {
+		return nil, fmt.Errorf("could not upload replacement, original asset was left in place: %w", err)
+	}
+
+	if err := deleteAsset(user, repo, token, old); err != nil {
+		if derr := deleteAsset(user, repo, token, asset); derr != nil {
+			return nil, fmt.Errorf("could not delete original asset (%w), nor the replacement uploaded as %s (%v)", err, tmpName, derr)
+		}
+		return nil, fmt.Errorf("could not delete original asset, it was left in place: %w", err)
+	}
+
+	err = policy.retry("rename "+tmpName, func(int) error {
+		err := renameAsset(user, repo, token, asset, old.Name)
+		if isTransient(err) {
+			return retryableError{err}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("original asset was deleted but the replacement could not be renamed, it is available as %s: %w", tmpName, err)
+	}
+	return asset, nil
+}
+
+// temporaryAssetName returns a name that is unlikely to clash with any
+// existing asset, used to stage a replacement for the asset called name.
+func temporaryAssetName(name string) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate temporary asset name: %v", err)
+	}
+	return fmt.Sprintf("%s.tmp-%x", name, b), nil
+}
+
+// printUploadSummary reports the outcome of every upload to w.
+func printUploadSummary(w io.Writer, files []*uploadFile) {
+	for _, f := range files {
+		if f.Err != nil {
+			fmt.Fprintf(w, "%s: failed: %v\n", f.Name, f.Err)
+		} else {
+			fmt.Fprintf(w, "%s: uploaded (id: %d, %s)\n", f.Name, f.Asset.Id, humanize.Bytes(f.Asset.Size))
+		}
+	}
+}
+
+// uploadAsset uploads file to rel as an asset called name, retrying
+// according to policy. Between attempts the file is rewound and any
+// incomplete asset left behind by the failed attempt is deleted.
+func uploadAsset(user, repo, authUser, token string, rel *Release, name, label string, file *os.File, policy RetryPolicy) (*Asset, error) {
+	var asset *Asset
+	err := policy.retry("upload "+name, func(attempt int) error {
+		if attempt > 1 {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("can't retry upload, input is not seekable: %v", err)
+			}
+			if err := deleteIncompleteAsset(user, repo, authUser, token, rel.Id, name); err != nil {
+				return err
+			}
+		}
+		var err error
+		asset, err = uploadOnce(user, repo, token, rel, name, label, file)
+		return err
+	})
+	return asset, err
+}
+
+// uploadURL returns the URL to upload assets of rel to, which is on the
+// configured upload endpoint if there is one.
+func uploadURL(rel *Release) string {
+	u := rel.CleanUploadUrl()
+	if EnvUploadEndpoint == "" {
+		return u
+	}
+	if i := strings.Index(u, "/repos/"); i != -1 {
+		return strings.TrimSuffix(EnvUploadEndpoint, "/") + u[i:]
+	}
+	return u
+}
+
+// deleteIncompleteAsset removes the asset called name from the release if a
+// previous upload left it behind in state "new".
+func deleteIncompleteAsset(user, repo, authUser, token string, id int, name string) error {
+	asset, err := findReleaseAsset(user, repo, authUser, token, id, name)
+	if err != nil {
+		return retryableError{err}
+	}
+	if asset == nil || asset.State != "new" {
+		return nil
+	}
+	vprintf("asset (id: %d) was left in state %s: removing...\n", asset.Id, asset.State)
+	if err := deleteAsset(user, repo, token, asset); err != nil {
+		return retryableError{err}
+	}
+	return nil
+}
+
+// uploadOnce performs a single upload request. Errors that may go away by
+// trying again are returned as retryableError.
+func uploadOnce(user, repo, token string, rel *Release, name, label string, file *os.File) (*Asset, error) {
+	body, size, err := github.MaterializeFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := body.(io.Closer); ok && body != io.Reader(file) {
+		defer c.Close()
+	}
+	progress := newProgressReader(body, name, 0, size)
+	defer progress.Close()
+	body = progress
+
+	asset, err := newClient("", token).UploadAsset(uploadURL(rel), name, label, body, size)
+	if err == nil {
+		return asset, nil
+	}
+	if asset != nil {
+		// The upload failed, but GitHub still retains metadata (an asset
+		// in state "new"). Attempt to delete that now since it would
+		// clutter the list of release assets.
+		vprintf("asset (id: %d) failed to upload, it's now in state %s: removing...\n", asset.Id, asset.State)
+		if derr := deleteAsset(user, repo, token, asset); derr != nil {
+			return nil, fmt.Errorf("upload failed (%w), could not delete partially uploaded asset (ID: %d, err: %v) in order to cleanly reset GH API state, please try again", err, asset.Id, derr)
+		}
+	}
+	if isTransient(err) {
+		return nil, retryableError{fmt.Errorf("could not upload, %w", err)}
+	}
+	return nil, fmt.Errorf("could not upload, %w", err)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAssets stands in for the asset endpoints of release 1 of o/r. A
+// request is answered with the next of the statuses in fail for its
+// description ("POST name", "GET id", "PATCH id" or "DELETE id"), if any.
+// "POST *" stands for all uploads.
+type fakeAssets struct {
+	mu       sync.Mutex
+	assets   map[int]*Asset
+	contents map[int]string // Served for asset downloads, by id.
+	nextId   int
+	fail     map[string][]int
+	requests []string
+}
+
+// newFakeAssets starts a fakeAssets holding assets and points the API
+// endpoint at it until the test ends. It returns the release to upload to.
+func newFakeAssets(t *testing.T, assets ...Asset) (*fakeAssets, *Release) {
+	f := &fakeAssets{assets: make(map[int]*Asset), contents: make(map[int]string), nextId: 100, fail: make(map[string][]int)}
+	for i := range assets {
+		f.assets[assets[i].Id] = &assets[i]
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	endpoint, upload, progress := EnvApiEndpoint, EnvUploadEndpoint, showProgress
+	t.Cleanup(func() { EnvApiEndpoint, EnvUploadEndpoint, showProgress = endpoint, upload, progress })
+	EnvApiEndpoint, EnvUploadEndpoint, showProgress = srv.URL, "", false
+	return f, &Release{Id: 1, UploadUrl: srv.URL + "/repos/o/r/releases/1/assets{?name,label}"}
+}
+
+func (f *fakeAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var what string
+	var id int
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/repos/o/r/releases/1/assets":
+		what = "POST " + r.URL.Query().Get("name")
+	case r.Method == "GET" && r.URL.Path == "/repos/o/r/releases/1/assets":
+		what = "GET"
+	case strings.HasPrefix(r.URL.Path, "/repos/o/r/releases/assets/"):
+		id, _ = strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/repos/o/r/releases/assets/"))
+		what = fmt.Sprintf("%s %d", r.Method, id)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	f.requests = append(f.requests, what)
+	key := what
+	if r.Method == "POST" && len(f.fail[key]) == 0 {
+		key = "POST *"
+	}
+	if statuses := f.fail[key]; len(statuses) > 0 {
+		f.fail[key] = statuses[1:]
+		w.WriteHeader(statuses[0])
+		fmt.Fprintf(w, `{"message": "%s failed"}`, what)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		body, _ := io.ReadAll(r.Body)
+		a := &Asset{Id: f.nextId, Name: r.URL.Query().Get("name"), Label: r.URL.Query().Get("label"), Size: uint64(len(body)), State: "uploaded"}
+		f.nextId++
+		f.assets[a.Id] = a
+		f.contents[a.Id] = string(body)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+	case "GET":
+		if id != 0 {
+			if _, ok := f.assets[id]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, f.contents[id])
+			return
+		}
+		list := []*Asset{}
+		for _, a := range f.assets {
+			list = append(list, a)
+		}
+		json.NewEncoder(w).Encode(list)
+	case "PATCH":
+		a, ok := f.assets[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(a)
+		json.NewEncoder(w).Encode(a)
+	case "DELETE":
+		if _, ok := f.assets[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(f.assets, id)
+		delete(f.contents, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// names returns the names of the assets, with their labels if any.
+func (f *fakeAssets) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, a := range f.assets {
+		name := a.Name
+		if a.Label != "" {
+			name += " (" + a.Label + ")"
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// listAssets returns a copy of the assets.
+func (f *fakeAssets) listAssets() []Asset {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var assets []Asset
+	for _, a := range f.assets {
+		assets = append(assets, *a)
+	}
+	return assets
+}
+
+func tempFile(t *testing.T, name, content string) *os.File {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestReplaceAsset(t *testing.T) {
+	old := Asset{Id: 1, Name: "a.zip", Label: "Linux", State: "uploaded"}
+	policy := RetryPolicy{Attempts: 3}
+
+	tests := []struct {
+		name      string
+		label     string
+		fail      map[string][]int
+		wantErr   string
+		wantNames []string // Assets left afterwards, with TMP for the temporary one.
+		wantReqs  int      // Number of PATCH requests.
+	}{
+		{
+			name:      "success keeps the label",
+			wantNames: []string{"a.zip (Linux)"},
+			wantReqs:  1,
+		},
+		{
+			name:      "new label",
+			label:     "Linux (amd64)",
+			wantNames: []string{"a.zip (Linux (amd64))"},
+			wantReqs:  1,
+		},
+		{
+			name:      "upload fails",
+			fail:      map[string][]int{"POST *": {http.StatusUnprocessableEntity}},
+			wantErr:   "original asset was left in place",
+			wantNames: []string{"a.zip (Linux)"},
+		},
+		{
+			name:      "delete of the original fails",
+			fail:      map[string][]int{"DELETE 1": {http.StatusForbidden}},
+			wantErr:   "could not delete original asset, it was left in place",
+			wantNames: []string{"a.zip (Linux)"},
+		},
+		{
+			name:      "rename fails",
+			fail:      map[string][]int{"PATCH 100": {http.StatusUnprocessableEntity}},
+			wantErr:   "the replacement could not be renamed, it is available as a.zip.tmp-",
+			wantNames: []string{"TMP (Linux)"},
+			wantReqs:  1,
+		},
+		{
+			name:      "rename is retried",
+			fail:      map[string][]int{"PATCH 100": {http.StatusBadGateway}},
+			wantNames: []string{"a.zip (Linux)"},
+			wantReqs:  2,
+		},
+	}
+	for _, tt := range tests {
+		f, rel := newFakeAssets(t, old)
+		for what, statuses := range tt.fail {
+			f.fail[what] = statuses
+		}
+
+		oldCopy := old
+		asset, err := replaceAsset("o", "r", "", "token", rel, &oldCopy, tt.label, tempFile(t, "a.zip", "new contents"), policy)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+		case err == nil && (asset.Name != "a.zip" || asset.Size != uint64(len("new contents"))):
+			t.Errorf("%s: got asset %+v", tt.name, asset)
+		}
+
+		names := f.names()
+		for i, name := range names {
+			if rest, ok := strings.CutPrefix(name, "a.zip.tmp-"); ok {
+				names[i] = "TMP" + strings.TrimLeft(rest, "0123456789abcdef")
+			}
+		}
+		if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+			t.Errorf("%s: assets left %q, want %q", tt.name, names, tt.wantNames)
+		}
+		patches := 0
+		for _, req := range f.requests {
+			if strings.HasPrefix(req, "PATCH") {
+				patches++
+			}
+		}
+		if patches != tt.wantReqs {
+			t.Errorf("%s: %d rename requests (%q), want %d", tt.name, patches, f.requests, tt.wantReqs)
+		}
+	}
+}
+
+func TestExpandUploadFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.zip", "b.zip", "c.txt", "sub/a.zip"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name     string
+		patterns []string
+		asset    string // The --name option.
+		want     []string
+		wantErr  string
+	}{
+		{name: "plain path", patterns: []string{in("c.txt")}, want: []string{"c.txt"}},
+		{name: "glob", patterns: []string{in("*.zip"), in("c.txt")}, want: []string{"a.zip", "b.zip", "c.txt"}},
+		{name: "no match", patterns: []string{in("*.tar.gz")}, wantErr: "did not match any files"},
+		{name: "invalid pattern", patterns: []string{in("[")}, wantErr: "invalid pattern"},
+		{name: "duplicates", patterns: []string{in("a.zip"), in("*.zip"), in("a.zip")}, want: []string{"a.zip", "b.zip"}},
+		{name: "same asset name", patterns: []string{in("a.zip"), in("sub/a.zip")}, wantErr: "would both be uploaded as a.zip"},
+		{name: "name", patterns: []string{in("a.zip")}, asset: "linux.zip", want: []string{"linux.zip"}},
+		{name: "name with several files", patterns: []string{in("*.zip")}, asset: "linux.zip", wantErr: "--name can only be used when uploading a single file, got 2 files"},
+		{name: "stdin", patterns: []string{"-"}, asset: "out.log", want: []string{"out.log"}},
+		{name: "stdin without name", patterns: []string{"-"}, wantErr: "uploading from stdin requires --name"},
+		{name: "nothing", wantErr: "no files to upload"},
+	}
+	for _, tt := range tests {
+		files, err := expandUploadFiles(tt.patterns, tt.asset)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %q, want %q", tt.name, names, tt.want)
+		}
+	}
+}
+
+func TestUploadFiles(t *testing.T) {
+	f, rel := newFakeAssets(t, Asset{Id: 1, Name: "c.zip", State: "new"})
+	f.fail["POST b.zip"] = []int{http.StatusUnprocessableEntity}
+
+	var files []*uploadFile
+	for _, name := range []string{"a.zip", "b.zip", "c.zip"} {
+		files = append(files, &uploadFile{Path: tempFile(t, name, "contents of "+name).Name(), Name: name})
+	}
+	assets := []Asset{{Id: 1, Name: "c.zip", State: "new"}}
+	err := uploadFiles("o", "r", "", "token", rel, assets, files, "", false, 2, RetryPolicy{Attempts: 1})
+	if err == nil || err.Error() != "1 of 3 uploads failed" {
+		t.Errorf("got error %v, want 1 of 3 uploads failed", err)
+	}
+
+	for _, file := range files {
+		switch {
+		case file.Name == "b.zip" && (file.Err == nil || file.Asset != nil):
+			t.Errorf("%s: got asset %+v, error %v, want an error", file.Name, file.Asset, file.Err)
+		case file.Name != "b.zip" && (file.Err != nil || file.Asset == nil || file.Asset.Name != file.Name):
+			t.Errorf("%s: got asset %+v, error %v", file.Name, file.Asset, file.Err)
+		}
+	}
+	var summary bytes.Buffer
+	printUploadSummary(&summary, files)
+	lines := strings.Split(strings.TrimSuffix(summary.String(), "\n"), "\n")
+	wantLines := []string{"a.zip: uploaded (id: 10", "b.zip: failed: could not upload, github returned 422", "c.zip: uploaded (id: 10"}
+	for i, want := range wantLines {
+		if len(lines) != len(wantLines) || !strings.HasPrefix(lines[i], want) {
+			t.Errorf("got summary\n%s\nwant lines starting with %q", summary.String(), wantLines)
+			break
+		}
+	}
+
+	names := f.names()
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a.zip,c.zip" {
+		t.Errorf("assets left %q, want the uploaded ones only", names)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"time"
+
+	"github.com/github-release/github-release/github"
 )
 
 /* nvls returns the first value in xs that is not empty. */
@@ -17,9 +19,17 @@ func nvls(xs ...string) string {
 	return ""
 }
 
+// newClient returns a client for the API at EnvApiEndpoint that
+// authenticates as authUser with token.
+func newClient(authUser, token string) github.Client {
+	client := github.NewClient(authUser, token, nil)
+	client.SetBaseURL(EnvApiEndpoint)
+	return client
+}
+
 func vprintln(a ...interface{}) (int, error) {
 	if VERBOSITY > 0 {
-		return fmt.Fprintln(os.Stderr, a...)
+		return fmt.Fprint(os.Stderr, github.Redact(fmt.Sprintln(a...)))
 	}
 
 	return 0, nil
@@ -27,7 +37,7 @@ func vprintln(a ...interface{}) (int, error) {
 
 func vprintf(format string, a ...interface{}) (int, error) {
 	if VERBOSITY > 0 {
-		return fmt.Fprintf(os.Stderr, format, a...)
+		return fmt.Fprint(os.Stderr, github.Redact(fmt.Sprintf(format, a...)))
 	}
 
 	return 0, nil